@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
@@ -9,54 +10,72 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/jacobdanielrose/httpfromtcp/internal/headers"
+	"github.com/jacobdanielrose/httpfromtcp/internal/middleware"
 	"github.com/jacobdanielrose/httpfromtcp/internal/request"
 	"github.com/jacobdanielrose/httpfromtcp/internal/response"
+	"github.com/jacobdanielrose/httpfromtcp/internal/router"
 	"github.com/jacobdanielrose/httpfromtcp/internal/server"
 )
 
 const port = 42069
+const shutdownTimeout = 10 * time.Second
 
 func main() {
-	server, err := server.Serve(port, handler)
+	routes := router.New()
+	routes.Handle("/httpbin/*", proxyHandler)
+	routes.Handle("/video", handlerVideo)
+	routes.Handle("/yourproblem", handler400)
+	routes.Handle("/myproblem", handler500)
+	routes.Handle("/*", handler200)
+
+	logger := log.Default()
+	handler := server.Chain(routes.Serve,
+		middleware.Logger(logger),
+		middleware.Recoverer(logger),
+	)
+
+	server, err := server.Serve(port, handler,
+		server.WithIdleTimeout(30*time.Second),
+		server.WithReadHeaderTimeout(10*time.Second),
+		server.WithWriteTimeout(time.Minute),
+		server.WithMaxRequestsPerConn(1000),
+	)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	log.Println("Server gracefully stopped")
-}
 
-func handler(w *response.Writer, req *request.Request) {
-	if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin/") {
-		proxyHandler(w, req)
-		return
-	}
-	if req.RequestLine.RequestTarget == "/video" {
-		handlerVideo(w, req)
-		return
-	}
-	if req.RequestLine.RequestTarget == "/yourproblem" {
-		handler400(w, req)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server forced to stop: %v", err)
 		return
 	}
-	if req.RequestLine.RequestTarget == "/myproblem" {
-		handler500(w, req)
-		return
-	}
-	handler200(w, req)
+	log.Println("Server gracefully stopped")
 }
 
 func proxyHandler(w *response.Writer, req *request.Request) {
-	target := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin/")
-	url := fmt.Sprintf("https://httpbin.org/%s", target)
+	// forward the path as sent, keeping its encoding, and the query
+	target := req.RequestLine.Target
+	path := strings.TrimPrefix(target.RawPath, "/httpbin")
+	if path == "" {
+		// "/httpbin" itself also matches the route
+		path = "/"
+	}
+	url := "https://httpbin.org" + path
+	if target.RawQuery != "" {
+		url += "?" + target.RawQuery
+	}
 	fmt.Println("Proxying to", url)
 	resp, err := http.Get(url)
 	if err != nil {
@@ -65,45 +84,22 @@ func proxyHandler(w *response.Writer, req *request.Request) {
 	}
 	defer resp.Body.Close()
 
-	w.WriteStatusLine(response.StatusOK)
-	h := response.GetDefaultHeaders(0)
-	h.Override("Content-Type", "text/html")
-	h.Set("Transfer-Encoding", "chunked")
-	h.Override("Trailer", "X-Content-SHA256, X-Content-Length")
-	h.Delete("Content-Length")
-	w.WriteHeaders(h)
-
-	fullBody := make([]byte, 0)
-
-	const maxChunkSize = 1024
-	buffer := make([]byte, maxChunkSize)
-	for {
-		n, err := resp.Body.Read(buffer)
-		fmt.Println("Read", n, "bytes")
-		if n > 0 {
-			_, err = w.WriteChunkedBody(buffer[:n])
-			if err != nil {
-				fmt.Println("Error writing chunked body:", err)
-				break
-			}
-			fullBody = append(fullBody, buffer[:n]...)
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			fmt.Println("Error reading response body:", err)
-			break
-		}
+	w.Header().Set("Content-Type", "text/html")
+	// declaring trailers makes the Writer use chunked encoding
+	w.Header().Set("Trailer", "X-Content-SHA256, X-Content-Length")
+
+	hash := sha256.New()
+	n, err := io.Copy(w, io.TeeReader(resp.Body, hash))
+	if err != nil {
+		fmt.Println("Error proxying body:", err)
 	}
 	_, err = w.WriteChunkedBodyDone()
 	if err != nil {
 		fmt.Println("Error writing chunked body done:", err)
 	}
 	trailers := headers.NewHeaders()
-	sha256 := fmt.Sprintf("%x", sha256.Sum256(fullBody))
-	trailers.Override("X-Content-SHA256", sha256)
-	trailers.Override("X-Content-Length", fmt.Sprintf("%d", len(fullBody)))
+	trailers.Set("X-Content-SHA256", fmt.Sprintf("%x", hash.Sum(nil)))
+	trailers.Set("X-Content-Length", fmt.Sprintf("%d", n))
 	err = w.WriteTrailers(trailers)
 	if err != nil {
 		fmt.Println("Error writing trailers:", err)
@@ -122,52 +118,44 @@ func handlerVideo(w *response.Writer, req *request.Request) {
 		return
 	}
 
-	w.WriteStatusLine(response.StatusOK)
-	h := response.GetDefaultHeaders(len(data))
-	h.Override("Content-Type", "video/mp4")
-	w.WriteHeaders(h)
-	_, err = w.WriteBody(data)
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, err = w.Write(data)
 	if err != nil {
 		fmt.Println("Error writing body:", err)
 	}
 }
 
 func handler400(w *response.Writer, _ *request.Request) {
-	w.WriteStatusLine(response.StatusBadRequest)
+	w.SetStatus(response.StatusBadRequest)
 	body := returnHTML(
 		response.StatusBadRequest,
 		response.StatusMessage[response.StatusBadRequest],
 		"Your request honestly kinda sucked.",
 	)
-	headers := response.GetDefaultHeaders(len(body))
-	headers.Override("Content-Type", "text/html")
-	w.WriteHeaders(headers)
-	w.WriteBody(body)
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(body)
 }
 func handler500(w *response.Writer, _ *request.Request) {
-	w.WriteStatusLine(response.StatusInternalServerError)
+	w.SetStatus(response.StatusInternalServerError)
 	body := returnHTML(
 		response.StatusInternalServerError,
 		response.StatusMessage[response.StatusInternalServerError],
 		"Okay, you know what? This one is on me.",
 	)
-	headers := response.GetDefaultHeaders(len(body))
-	headers.Override("Content-Type", "text/html")
-	w.WriteHeaders(headers)
-	w.WriteBody(body)
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(body)
 }
 
 func handler200(w *response.Writer, _ *request.Request) {
-	w.WriteStatusLine(response.StatusOK)
+	w.SetStatus(response.StatusOK)
 	body := returnHTML(
 		response.StatusOK,
 		"Success!",
 		"Your request was an absolute banger.",
 	)
-	headers := response.GetDefaultHeaders(len(body))
-	headers.Override("Content-Type", "text/html")
-	w.WriteHeaders(headers)
-	w.WriteBody(body)
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(body)
 }
 
 func returnHTML(statusCode response.StatusCode, statusMsg string, messageBody string) []byte {
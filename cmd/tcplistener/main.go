@@ -36,7 +36,7 @@ func main() {
 		fmt.Printf("- Target: %s\n", request.RequestLine.RequestTarget)
 		fmt.Printf("- Version: %s\n", request.RequestLine.HttpVersion)
 		fmt.Println("Headers:")
-		for key, value := range request.Headers {
+		for key, value := range request.Headers.All() {
 			fmt.Printf("- %s: %s\n", key, value)
 		}
 		fmt.Println("Body:")
@@ -2,20 +2,65 @@ package headers
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"regexp"
+	"iter"
 	"strings"
 )
 
 const crlf = "\r\n"
 
-type Headers map[string]string
+var (
+	// ErrMissingColon means a field line has no colon separating the name
+	// from the value.
+	ErrMissingColon = errors.New("malformed header: missing colon")
+	// ErrInvalidFieldName means a field name is empty, contains characters
+	// outside the token set, or is followed by whitespace before the colon.
+	ErrInvalidFieldName = errors.New("invalid header name")
+	// ErrInvalidFieldValue means a field value contains a control character
+	// such as NUL or a bare CR.
+	ErrInvalidFieldValue = errors.New("invalid header value")
+	// ErrObsFold means a field value was continued on a line starting with
+	// whitespace, and the parser is set to reject obsolete line folding.
+	ErrObsFold = errors.New("obsolete line folding not allowed")
+)
+
+// Headers is an ordered collection of header fields. Field names are matched
+// case-insensitively but keep the casing they were first added with, and a
+// field keeps each of its values separately, in the order they arrived.
+type Headers struct {
+	fields []field
+	// lastParsed is the name of the field Parse added last, which an
+	// obs-fold continuation line extends
+	lastParsed string
+}
+
+type field struct {
+	name   string
+	values []string
+}
+
+// ParseOptions configures how field lines are parsed. The zero value is the
+// strict RFC 9112 behaviour.
+type ParseOptions struct {
+	// UnfoldObsFold accepts obsolete line folding, replacing each fold with
+	// a single space, instead of rejecting it with ErrObsFold.
+	UnfoldObsFold bool
+}
 
-func NewHeaders() Headers {
-	return map[string]string{}
+func NewHeaders() *Headers {
+	return &Headers{}
 }
 
-func (h Headers) Parse(data []byte) (n int, done bool, err error) {
+// Parse parses one field line from data with the default ParseOptions.
+func (h *Headers) Parse(data []byte) (n int, done bool, err error) {
+	return h.ParseWith(data, ParseOptions{})
+}
+
+// ParseWith parses one field line from data. It returns n == 0 when data
+// does not hold a complete line yet, and done once it consumes the empty line
+// ending the section.
+func (h *Headers) ParseWith(data []byte, opts ParseOptions) (n int, done bool, err error) {
 	idx := bytes.Index(data, []byte(crlf))
 
 	if idx == -1 {
@@ -28,64 +73,215 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 		return 2, true, nil
 	}
 
-	parts := bytes.SplitN(data[:idx], []byte(":"), 2)
+	line := data[:idx]
+	if isWhitespace(line[0]) && h.lastParsed != "" {
+		if !opts.UnfoldObsFold {
+			return 0, false, ErrObsFold
+		}
+		if err := h.unfold(line); err != nil {
+			return 0, false, err
+		}
+		return idx + 2, false, nil
+	}
+
+	parts := bytes.SplitN(line, []byte(":"), 2)
 	if len(parts) != 2 {
-		return 0, false, fmt.Errorf("malformed header: missing colon")
+		return 0, false, ErrMissingColon
 	}
 
-	key := strings.ToLower(string(parts[0]))
+	key := string(parts[0])
 
-	if key != strings.TrimRight(key, " ") {
-		return 0, false, fmt.Errorf("invalid header name: %s", key)
+	if key != strings.TrimRight(key, " \t") {
+		return 0, false, fmt.Errorf("%w: %q", ErrInvalidFieldName, key)
 	}
 
-	value := bytes.TrimSpace(parts[1])
-	key = strings.TrimSpace(key)
+	value := bytes.Trim(parts[1], " \t")
+	key = strings.TrimLeft(key, " \t")
 
-	matched, err := regexp.MatchString("^[A-Za-z0-9_!#$%&`'+._|~-]+$", key)
-	if err != nil {
-		return 0, false, err
+	if !isToken(key) {
+		return 0, false, fmt.Errorf("%w: %q", ErrInvalidFieldName, key)
 	}
-	if !matched {
-		return 0, false, fmt.Errorf("invalid header name: %s", key)
+	if !isFieldValue(value) {
+		return 0, false, fmt.Errorf("%w for %s: %q", ErrInvalidFieldValue, key, value)
 	}
 
-	existingVal, exists := h[key]
-	if exists {
-		h.Set(key, existingVal+", "+string(value))
-	} else {
-		h.Set(key, string(value))
-	}
+	h.Add(key, string(value))
+	h.lastParsed = key
 
 	return idx + 2, false, nil
 }
 
-func (h Headers) Set(key, value string) {
-	key = strings.ToLower(key)
-	v, ok := h[key]
-	if ok {
-		value = strings.Join([]string{
-			v,
-			value,
-		}, ", ")
+// unfold appends an obs-fold continuation line to the last value parsed,
+// joined by a single space.
+func (h *Headers) unfold(line []byte) error {
+	value := bytes.Trim(line, " \t")
+	if !isFieldValue(value) {
+		return fmt.Errorf("%w for %s: %q", ErrInvalidFieldValue, h.lastParsed, value)
 	}
-	h[key] = value
+	i := h.find(h.lastParsed)
+	if i == -1 {
+		// the field was deleted since it was parsed
+		return ErrObsFold
+	}
+	values := h.fields[i].values
+	last := values[len(values)-1]
+	if last != "" && len(value) > 0 {
+		last += " "
+	}
+	values[len(values)-1] = last + string(value)
+	return nil
 }
 
-func (h Headers) Override(key, value string) {
-	key = strings.ToLower(key)
-	h[key] = value
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t'
 }
 
-func (h Headers) Get(key string) (string, bool) {
-	key = strings.ToLower(key)
-	v, ok := h[key]
-	return v, ok
+// isToken reports whether s is a non-empty RFC 9110 token, the syntax of a
+// field name.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) != -1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isFieldValue reports whether v is a valid RFC 9110 field value: visible
+// characters, obs-text and interior spaces or tabs, but no other controls.
+func isFieldValue(v []byte) bool {
+	for _, c := range v {
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Headers) find(key string) int {
+	for i, f := range h.fields {
+		if strings.EqualFold(f.name, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add appends value to the field, adding the field at the end if it is not
+// present yet.
+func (h *Headers) Add(key, value string) {
+	if i := h.find(key); i != -1 {
+		h.fields[i].values = append(h.fields[i].values, value)
+		return
+	}
+	h.fields = append(h.fields, field{name: key, values: []string{value}})
+}
+
+// Set replaces every value of the field with value. An existing field keeps
+// its position and casing.
+func (h *Headers) Set(key, value string) {
+	if i := h.find(key); i != -1 {
+		h.fields[i].values = []string{value}
+		return
+	}
+	h.fields = append(h.fields, field{name: key, values: []string{value}})
+}
+
+// Get returns the field's values combined into one comma-separated value, as
+// a recipient may do for any field that can appear more than once. Use
+// Values for fields like Set-Cookie that cannot be combined.
+func (h *Headers) Get(key string) (string, bool) {
+	i := h.find(key)
+	if i == -1 {
+		return "", false
+	}
+	return strings.Join(h.fields[i].values, ", "), true
 }
 
-func (h Headers) Delete(key string) (string, bool) {
-	key = strings.ToLower(key)
-	v, ok := h[key]
-	delete(h, key)
+// Values returns the field's values in the order they were added.
+func (h *Headers) Values(key string) []string {
+	i := h.find(key)
+	if i == -1 {
+		return nil
+	}
+	return h.fields[i].values
+}
+
+// Del removes the field, returning its combined value.
+func (h *Headers) Del(key string) (string, bool) {
+	v, ok := h.Get(key)
+	if ok {
+		i := h.find(key)
+		h.fields = append(h.fields[:i], h.fields[i+1:]...)
+	}
 	return v, ok
 }
+
+// Len returns the number of distinct fields.
+func (h *Headers) Len() int {
+	return len(h.fields)
+}
+
+// All yields every field line in order, once per value, with the field name
+// in its original casing.
+func (h *Headers) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for _, f := range h.fields {
+			for _, v := range f.values {
+				if !yield(f.name, v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// HasToken reports whether the comma-separated list in the named field
+// contains token, compared case-insensitively (e.g. "Connection: close").
+func (h *Headers) HasToken(key, token string) bool {
+	for _, v := range h.Values(key) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canonicalExceptions are field names whose conventional spelling differs
+// from plain word capitalisation.
+var canonicalExceptions = map[string]string{
+	"content-md5":      "Content-MD5",
+	"dnt":              "DNT",
+	"etag":             "ETag",
+	"te":               "TE",
+	"www-authenticate": "WWW-Authenticate",
+	"x-xss-protection": "X-XSS-Protection",
+}
+
+// CanonicalKey returns the conventional spelling of a field name: each
+// dash-separated word capitalised, as in "Content-Type", with a few
+// established exceptions such as "ETag".
+func CanonicalKey(key string) string {
+	lower := strings.ToLower(key)
+	if c, ok := canonicalExceptions[lower]; ok {
+		return c
+	}
+	b := []byte(lower)
+	upper := true
+	for i, c := range b {
+		if upper && 'a' <= c && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
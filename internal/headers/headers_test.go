@@ -14,7 +14,7 @@ func TestFieldLineParse(t *testing.T) {
 	n, done, err := headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -24,18 +24,19 @@ func TestFieldLineParse(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
 	assert.Equal(t, 57, n)
 	assert.False(t, done)
 
 	// Test: Valid 2 headers with existing headers
-	headers = map[string]string{"host": "localhost:42069"}
+	headers = NewHeaders()
+	headers.Set("host", "localhost:42069")
 	data = []byte("User-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
-	assert.Equal(t, "curl/7.81.0", headers["user-agent"])
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
+	assert.Equal(t, "curl/7.81.0", get(headers, "user-agent"))
 	assert.Equal(t, 25, n)
 	assert.False(t, done)
 
@@ -45,7 +46,7 @@ func TestFieldLineParse(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Empty(t, headers)
+	assert.Equal(t, 0, headers.Len())
 	assert.Equal(t, 2, n)
 	assert.True(t, done)
 
@@ -63,7 +64,7 @@ func TestFieldLineParse(t *testing.T) {
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069", headers["host"])
+	assert.Equal(t, "localhost:42069", get(headers, "host"))
 	assert.Equal(t, 23, n)
 	assert.False(t, done)
 
@@ -77,12 +78,127 @@ func TestFieldLineParse(t *testing.T) {
 	assert.False(t, done)
 
 	// Test: Valid 2 headers with existing headers
-	headers = map[string]string{"host": "localhost:42069"}
+	headers = NewHeaders()
+	headers.Set("host", "localhost:42069")
 	data = []byte("host: localhost:9191\r\n")
 	n, done, err = headers.Parse(data)
 	require.NoError(t, err)
 	require.NotNil(t, headers)
-	assert.Equal(t, "localhost:42069, localhost:9191", headers["host"])
+	assert.Equal(t, "localhost:42069, localhost:9191", get(headers, "host"))
 	assert.Equal(t, 22, n)
 	assert.False(t, done)
 }
+
+func get(h *Headers, key string) string {
+	v, _ := h.Get(key)
+	return v
+}
+
+func TestMultiValueHeaders(t *testing.T) {
+	// Test: Repeated fields keep each value in order and the first casing
+	headers := NewHeaders()
+	data := []byte("Set-Cookie: a=1\r\nHost: localhost\r\nset-cookie: b=2\r\n\r\n")
+	for {
+		n, done, err := headers.Parse(data)
+		require.NoError(t, err)
+		data = data[n:]
+		if done {
+			break
+		}
+	}
+	assert.Equal(t, []string{"a=1", "b=2"}, headers.Values("set-cookie"))
+	assert.Equal(t, "a=1, b=2", get(headers, "SET-COOKIE"))
+	var lines []string
+	for name, value := range headers.All() {
+		lines = append(lines, name+": "+value)
+	}
+	assert.Equal(t, []string{"Set-Cookie: a=1", "Set-Cookie: b=2", "Host: localhost"}, lines)
+
+	// Test: Set replaces values in place, Add appends, Del removes
+	headers.Set("host", "example.com")
+	headers.Add("X-Trace", "1")
+	headers.Add("x-trace", "2")
+	_, ok := headers.Del("Set-Cookie")
+	assert.True(t, ok)
+	lines = nil
+	for name, value := range headers.All() {
+		lines = append(lines, name+": "+value)
+	}
+	assert.Equal(t, []string{"Host: example.com", "X-Trace: 1", "X-Trace: 2"}, lines)
+	assert.Nil(t, headers.Values("set-cookie"))
+	_, ok = headers.Get("set-cookie")
+	assert.False(t, ok)
+}
+
+func TestCanonicalKey(t *testing.T) {
+	assert.Equal(t, "Content-Type", CanonicalKey("content-type"))
+	assert.Equal(t, "Content-Type", CanonicalKey("CONTENT-TYPE"))
+	assert.Equal(t, "X-Request-Id", CanonicalKey("x-request-id"))
+	assert.Equal(t, "ETag", CanonicalKey("etag"))
+	assert.Equal(t, "WWW-Authenticate", CanonicalKey("www-authenticate"))
+	assert.Equal(t, "Host", CanonicalKey("host"))
+}
+
+func TestFieldValueValidation(t *testing.T) {
+	// Test: Tabs, spaces and obs-text are allowed inside a value
+	headers := NewHeaders()
+	n, _, err := headers.Parse([]byte("X-Note: caf\xe9\tau lait\r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 22, n)
+	assert.Equal(t, "caf\xe9\tau lait", get(headers, "x-note"))
+
+	// Test: NUL, bare CR and other controls are rejected
+	for _, line := range []string{
+		"X-Bad: a\x00b\r\n",
+		"X-Bad: a\rb\r\n",
+		"X-Bad: a\nb\r\n",
+		"X-Bad: a\x7fb\r\n",
+	} {
+		headers = NewHeaders()
+		n, done, err := headers.Parse([]byte(line))
+		require.ErrorIs(t, err, ErrInvalidFieldValue, line)
+		assert.Equal(t, 0, n)
+		assert.False(t, done)
+	}
+
+	// Test: Field names use the full token character set
+	headers = NewHeaders()
+	_, _, err = headers.Parse([]byte("X-Star*^: 1\r\n"))
+	require.NoError(t, err)
+
+	// Test: Typed errors for malformed names and missing colons
+	_, _, err = NewHeaders().Parse([]byte("H@ST: localhost\r\n"))
+	require.ErrorIs(t, err, ErrInvalidFieldName)
+	_, _, err = NewHeaders().Parse([]byte("Host\tx: localhost\r\n"))
+	require.ErrorIs(t, err, ErrInvalidFieldName)
+	_, _, err = NewHeaders().Parse([]byte("Host localhost\r\n"))
+	require.ErrorIs(t, err, ErrMissingColon)
+}
+
+func TestObsFold(t *testing.T) {
+	data := "X-Long: first\r\n   second\r\n\tthird\r\nHost: localhost\r\n\r\n"
+	parseAll := func(opts ParseOptions) (*Headers, error) {
+		headers := NewHeaders()
+		rest := []byte(data)
+		for {
+			n, done, err := headers.ParseWith(rest, opts)
+			if err != nil {
+				return nil, err
+			}
+			rest = rest[n:]
+			if done {
+				return headers, nil
+			}
+		}
+	}
+
+	// Test: Rejected by default
+	_, err := parseAll(ParseOptions{})
+	require.ErrorIs(t, err, ErrObsFold)
+
+	// Test: Unfolded into single spaces when enabled
+	headers, err := parseAll(ParseOptions{UnfoldObsFold: true})
+	require.NoError(t, err)
+	assert.Equal(t, "first second third", get(headers, "x-long"))
+	assert.Equal(t, "localhost", get(headers, "host"))
+}
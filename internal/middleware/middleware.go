@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/request"
+	"github.com/jacobdanielrose/httpfromtcp/internal/response"
+	"github.com/jacobdanielrose/httpfromtcp/internal/server"
+)
+
+// Logger logs the method, target, status, body size and duration of every
+// request.
+func Logger(logger *log.Logger) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			next(w, req)
+			status := w.Status()
+			if status == 0 {
+				status = response.StatusOK
+			}
+			logger.Printf("%s %s %d %dB (%v)", req.RequestLine.Method, req.RequestLine.RequestTarget,
+				status, w.BytesWritten(), time.Since(start))
+		}
+	}
+}
+
+// Recoverer turns a panicking handler into a 500 response instead of letting
+// the panic take down the connection's goroutine.
+func Recoverer(logger *log.Logger) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			defer func() {
+				if p := recover(); p != nil {
+					logger.Printf("panic serving %s: %v\n%s", req.RequestLine.RequestTarget, p, debug.Stack())
+					if w.Written() {
+						// too late for a clean 500; let the server drop the connection
+						panic(p)
+					}
+					w.Reset()
+					w.SetClose(true)
+					w.WriteStatusLine(response.StatusInternalServerError)
+					body := []byte("Internal Server Error\n")
+					w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+					w.WriteBody(body)
+				}
+			}()
+			next(w, req)
+		}
+	}
+}
+
+// BasicAuth rejects requests whose Authorization header does not carry
+// credentials accepted by valid, answering 401 with a challenge for realm.
+func BasicAuth(realm string, valid func(user, password string) bool) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w *response.Writer, req *request.Request) {
+			user, password, ok := basicAuth(req)
+			if !ok || !valid(user, password) {
+				w.WriteStatusLine(response.StatusUnauthorized)
+				body := []byte("Unauthorized\n")
+				h := response.GetDefaultHeaders(len(body))
+				h.Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+				w.WriteHeaders(h)
+				w.WriteBody(body)
+				return
+			}
+			next(w, req)
+		}
+	}
+}
+
+// StaticCredentials is a BasicAuth validator accepting a single user.
+func StaticCredentials(user, password string) func(string, string) bool {
+	return func(u, p string) bool {
+		userOK := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+		passwordOK := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+		return userOK && passwordOK
+	}
+}
+
+func basicAuth(req *request.Request) (user, password string, ok bool) {
+	auth, ok := req.Headers.Get("Authorization")
+	if !ok {
+		return "", "", false
+	}
+	scheme, encoded, ok := strings.Cut(auth, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
@@ -0,0 +1,85 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+var errBodyClosed = errors.New("read on closed request body")
+
+// body is the io.ReadCloser behind Request.BodyReader. It drives the
+// request's parser just far enough to satisfy each Read.
+type body struct {
+	req    *Request
+	reader *Reader
+	closed bool
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, errBodyClosed
+	}
+	if b.req.bodyErr != nil {
+		return 0, b.req.bodyErr
+	}
+	for {
+		if len(b.req.pending) > 0 {
+			n := copy(p, b.req.pending)
+			b.req.pending = b.req.pending[n:]
+			return n, nil
+		}
+		if b.req.state == requestStateDone {
+			return 0, io.EOF
+		}
+		if fn := b.req.onBodyRead; fn != nil {
+			b.req.onBodyRead = nil
+			if err := fn(); err != nil {
+				return 0, err
+			}
+		}
+		if err := b.reader.advance(b.req); err != nil {
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				b.req.bodyErr = err
+			}
+			return 0, err
+		}
+	}
+}
+
+// Close stops the handler from reading any further. The unread remainder of
+// the body is discarded by the Reader before the next request.
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
+
+// BodyError returns the ParseError that stopped the body from being read,
+// such as a malformed chunk or a body over Limits.MaxBodyBytes. It lets the
+// server answer a bad body even if the handler ignored the error.
+func (r *Request) BodyError() error {
+	return r.bodyErr
+}
+
+// BodyTooLargeToDiscard reports whether the unread rest of a Content-Length
+// body is more than DiscardBody will skip, so the connection has to be closed
+// after the response. A chunked body only reveals its size as it is read.
+func (r *Request) BodyTooLargeToDiscard() bool {
+	if r.state != requestStateParsingFixedBody {
+		return false
+	}
+	return r.contentLength-r.bodyLengthRead+len(r.pending) > maxDiscardBytes
+}
+
+// BufferBody reads the rest of the body into Body and replaces BodyReader
+// with a reader over the buffered bytes.
+func (r *Request) BufferBody() error {
+	data, err := io.ReadAll(r.BodyReader)
+	if err != nil {
+		return err
+	}
+	r.Body = data
+	r.BodyReader = io.NopCloser(bytes.NewReader(data))
+	return nil
+}
@@ -0,0 +1,61 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrMalformedRequestLine means the request line is not
+	// "method SP request-target SP HTTP-version".
+	ErrMalformedRequestLine = errors.New("malformed request line")
+	// ErrInvalidMethod means the method contains characters other than
+	// upper-case letters.
+	ErrInvalidMethod = errors.New("invalid method")
+	// ErrUnsupportedVersion means the request is well formed but uses an
+	// HTTP version the server does not speak (505 HTTP Version Not
+	// Supported).
+	ErrUnsupportedVersion = errors.New("unsupported HTTP version")
+	// ErrMalformedChunk means a chunked body has a bad chunk size line,
+	// chunk extension or chunk terminator.
+	ErrMalformedChunk = errors.New("malformed chunk")
+	// ErrUnexpectedEOF means the connection ended partway through a
+	// request. It also matches io.ErrUnexpectedEOF.
+	ErrUnexpectedEOF = fmt.Errorf("incomplete request: %w", io.ErrUnexpectedEOF)
+)
+
+// ParseError reports which part of a request could not be parsed. Err is one
+// of the sentinel errors of this package or of the headers package, possibly
+// wrapped with detail, so callers can match it with errors.Is.
+type ParseError struct {
+	// Section is the part of the request being parsed: "request line",
+	// "headers", "body" or "trailers".
+	Section string
+	// Version is the HTTP version from the request line, "1.0" or "1.1",
+	// so the error can be answered in it. It is empty if the request line
+	// was not parsed.
+	Version string
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parsing %s: %v", e.Section, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func (s requestState) section() string {
+	switch s {
+	case requestStateInitialized:
+		return "request line"
+	case requestStateParsingHeaders:
+		return "headers"
+	case requestStateParsingTrailers:
+		return "trailers"
+	default:
+		return "body"
+	}
+}
@@ -0,0 +1,51 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupportedExpectation means the request has an Expect header other
+// than "100-continue" (417 Expectation Failed).
+var ErrUnsupportedExpectation = errors.New("unsupported expectation")
+
+// errBodyWithheld stops the Reader from waiting for a body that the client
+// may never send because the 100 Continue it asked for was never sent.
+var errBodyWithheld = errors.New("request body withheld awaiting 100 Continue")
+
+// checkExpect accepts only the 100-continue expectation. HTTP/1.0 clients
+// cannot understand a 1xx response, so there the header is ignored.
+func (r *Request) checkExpect() error {
+	if r.RequestLine.HttpVersion == "1.0" {
+		return nil
+	}
+	values := r.Headers.Values("Expect")
+	for _, v := range values {
+		if !strings.EqualFold(strings.TrimSpace(v), "100-continue") {
+			return fmt.Errorf("%w: %q", ErrUnsupportedExpectation, v)
+		}
+	}
+	return nil
+}
+
+// ExpectsContinue reports whether the client is waiting for a 100 Continue
+// before it sends the body.
+func (r *Request) ExpectsContinue() bool {
+	return r.RequestLine.HttpVersion != "1.0" && r.Headers.HasToken("Expect", "100-continue")
+}
+
+// OnBodyRead registers fn to run once, just before the body is first read
+// from the connection; an error from fn fails that read. The server uses it
+// to send 100 Continue only once the handler asks for the body. If the body
+// is never read, the Reader will not wait for it before the next request.
+func (r *Request) OnBodyRead(fn func() error) {
+	r.onBodyRead = fn
+}
+
+// BodyWithheld reports whether the client may still be holding the body
+// back, because the OnBodyRead hook never ran and the body is unfinished.
+// Such a body cannot be skipped to reach the next request.
+func (r *Request) BodyWithheld() bool {
+	return r.onBodyRead != nil && r.state != requestStateDone
+}
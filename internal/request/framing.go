@@ -0,0 +1,120 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Errors for requests whose body length is ambiguous under the RFC 9112
+// section 6.3 message length rules. Intermediaries can disagree about where
+// such a request ends, which is how request smuggling works, so each of them
+// is rejected outright rather than resolved.
+var (
+	// ErrInvalidContentLength means a Content-Length value is not a plain
+	// decimal number: signs, spaces, hex and empty values are all rejected.
+	ErrInvalidContentLength = errors.New("invalid Content-Length")
+	// ErrConflictingContentLength means the request carries several
+	// Content-Length values that are not all the same.
+	ErrConflictingContentLength = errors.New("conflicting Content-Length values")
+	// ErrContentLengthWithTransferEncoding means the request carries both
+	// Content-Length and Transfer-Encoding.
+	ErrContentLengthWithTransferEncoding = errors.New("both Content-Length and Transfer-Encoding present")
+	// ErrChunkedNotFinal means Transfer-Encoding does not end with a single
+	// "chunked", so the body length cannot be determined.
+	ErrChunkedNotFinal = errors.New("Transfer-Encoding must end with chunked")
+	// ErrTransferEncodingHTTP10 means an HTTP/1.0 request carries
+	// Transfer-Encoding, which that version does not define.
+	ErrTransferEncodingHTTP10 = errors.New("Transfer-Encoding in an HTTP/1.0 request")
+	// ErrUnsupportedTransferEncoding means the request uses a transfer
+	// coding other than chunked, which the server cannot decode.
+	ErrUnsupportedTransferEncoding = errors.New("unsupported Transfer-Encoding")
+)
+
+// maxContentLengthDigits keeps Content-Length values within an int64.
+const maxContentLengthDigits = 18
+
+// bodyFraming decides how the body of r is delimited. It returns whether the
+// body is chunked and, if not, its length; a request with neither header has
+// no body.
+func (r *Request) bodyFraming() (chunked bool, contentLength int64, err error) {
+	teValues := r.Headers.Values("transfer-encoding")
+	clValues := r.Headers.Values("content-length")
+
+	if len(teValues) > 0 {
+		if r.RequestLine.HttpVersion == "1.0" {
+			return false, 0, ErrTransferEncodingHTTP10
+		}
+		if len(clValues) > 0 {
+			return false, 0, ErrContentLengthWithTransferEncoding
+		}
+		if err := checkTransferEncoding(teValues); err != nil {
+			return false, 0, err
+		}
+		return true, 0, nil
+	}
+
+	if len(clValues) == 0 {
+		return false, 0, nil
+	}
+	contentLength, err = parseContentLength(clValues)
+	return false, contentLength, err
+}
+
+// checkTransferEncoding accepts only "chunked" as the sole transfer coding.
+func checkTransferEncoding(values []string) error {
+	var codings []string
+	for _, v := range values {
+		for _, coding := range strings.Split(v, ",") {
+			codings = append(codings, strings.ToLower(strings.TrimSpace(coding)))
+		}
+	}
+	if codings[len(codings)-1] != "chunked" {
+		return fmt.Errorf("%w: %s", ErrChunkedNotFinal, strings.Join(values, ", "))
+	}
+	if len(codings) == 1 {
+		return nil
+	}
+	if slices.Contains(codings[:len(codings)-1], "chunked") {
+		return fmt.Errorf("%w: chunked applied more than once", ErrChunkedNotFinal)
+	}
+	return fmt.Errorf("%w: %s", ErrUnsupportedTransferEncoding, codings[0])
+}
+
+// parseContentLength parses the Content-Length field lines, each of which may
+// itself be a comma-separated list. Repeats of the same value are accepted as
+// one, as RFC 9110 section 8.6 allows; differing values are not.
+func parseContentLength(values []string) (int64, error) {
+	length := int64(-1)
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if !isDecimal(part) || len(part) > maxContentLengthDigits {
+				return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, v)
+			}
+			n, err := strconv.ParseInt(part, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, v)
+			}
+			if length != -1 && n != length {
+				return 0, fmt.Errorf("%w: %s", ErrConflictingContentLength, strings.Join(values, ", "))
+			}
+			length = n
+		}
+	}
+	return length, nil
+}
+
+func isDecimal(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrMissingHost means an HTTP/1.1 request has no Host header.
+	ErrMissingHost = errors.New("missing Host header")
+	// ErrDuplicateHost means a request has more than one Host header, or a
+	// Host header listing several hosts.
+	ErrDuplicateHost = errors.New("more than one Host header")
+	// ErrInvalidHost means the Host header is not a valid host and port.
+	ErrInvalidHost = errors.New("invalid Host header")
+)
+
+// checkHost applies RFC 9112 section 3.2: an HTTP/1.1 request carries exactly
+// one Host header, HTTP/1.0 at most one. The value may be empty only when the
+// target has no authority to repeat.
+func (r *Request) checkHost() error {
+	values := r.Headers.Values("Host")
+	switch {
+	case len(values) == 0 && r.RequestLine.HttpVersion == "1.0":
+		return nil
+	case len(values) == 0:
+		return ErrMissingHost
+	case len(values) > 1 || strings.Contains(values[0], ","):
+		return fmt.Errorf("%w: %s", ErrDuplicateHost, strings.Join(values, ", "))
+	case values[0] == "" && r.RequestLine.Target.Host != "":
+		return fmt.Errorf("%w: empty, but the target has an authority", ErrInvalidHost)
+	case values[0] != "" && !validHost(values[0]):
+		return fmt.Errorf("%w: %q", ErrInvalidHost, values[0])
+	}
+	return nil
+}
+
+// Host returns the host the request is addressed to, including any port. An
+// absolute-form or authority-form target takes precedence over the Host
+// header, which a client must send but a server must ignore in that case.
+func (r *Request) Host() string {
+	if r.RequestLine.Target.Host != "" {
+		return r.RequestLine.Target.Host
+	}
+	host, _ := r.Headers.Get("Host")
+	return host
+}
@@ -0,0 +1,88 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrRequestLineTooLong means the request line exceeded
+	// Limits.MaxRequestLineBytes (414 URI Too Long).
+	ErrRequestLineTooLong = errors.New("request line too long")
+	// ErrHeaderTooLarge means a header field or the header section exceeded
+	// one of the header limits (431 Request Header Fields Too Large).
+	ErrHeaderTooLarge = errors.New("request header fields too large")
+	// ErrBodyTooLarge means the body exceeded Limits.MaxBodyBytes
+	// (413 Content Too Large).
+	ErrBodyTooLarge = errors.New("request body too large")
+)
+
+// Limits caps how much of a request the parser will accept. A zero field
+// means no limit.
+type Limits struct {
+	// MaxRequestLineBytes caps the request line, excluding its CRLF.
+	MaxRequestLineBytes int
+	// MaxHeaderLineBytes caps a single header or trailer field line.
+	MaxHeaderLineBytes int
+	// MaxHeaderBytes caps the whole header section, and separately the
+	// trailer section of a chunked body.
+	MaxHeaderBytes int
+	// MaxHeaderCount caps the number of header, or trailer, field lines.
+	MaxHeaderCount int
+	// MaxBodyBytes caps the decoded body.
+	MaxBodyBytes int64
+}
+
+// DefaultLimits are the limits a new Reader starts with. The body is left
+// unlimited since it is streamed rather than buffered.
+var DefaultLimits = Limits{
+	MaxRequestLineBytes: 8 << 10,
+	MaxHeaderLineBytes:  8 << 10,
+	MaxHeaderBytes:      1 << 20,
+	MaxHeaderCount:      100,
+}
+
+func exceeds(n int, limit int) bool {
+	return limit > 0 && n > limit
+}
+
+// checkRequestLine rejects a request line that is already over the limit,
+// whether or not its CRLF has arrived yet.
+func (l Limits) checkRequestLine(data []byte) error {
+	lineLen := bytes.Index(data, []byte(crlf))
+	if lineLen == -1 {
+		lineLen = len(data)
+	}
+	if exceeds(lineLen, l.MaxRequestLineBytes) {
+		return fmt.Errorf("%w: more than %d bytes", ErrRequestLineTooLong, l.MaxRequestLineBytes)
+	}
+	return nil
+}
+
+// checkFieldLine rejects the next header or trailer line when it would push
+// the section over its limits. sectionBytes and fieldCount describe the lines
+// already parsed in the section.
+func (l Limits) checkFieldLine(data []byte, sectionBytes, fieldCount int) error {
+	lineLen := bytes.Index(data, []byte(crlf))
+	if lineLen == -1 {
+		lineLen = len(data)
+	}
+	if exceeds(lineLen, l.MaxHeaderLineBytes) {
+		return fmt.Errorf("%w: field line longer than %d bytes", ErrHeaderTooLarge, l.MaxHeaderLineBytes)
+	}
+	if exceeds(sectionBytes+lineLen, l.MaxHeaderBytes) {
+		return fmt.Errorf("%w: more than %d bytes", ErrHeaderTooLarge, l.MaxHeaderBytes)
+	}
+	if lineLen > 0 && exceeds(fieldCount+1, l.MaxHeaderCount) {
+		return fmt.Errorf("%w: more than %d fields", ErrHeaderTooLarge, l.MaxHeaderCount)
+	}
+	return nil
+}
+
+func (l Limits) checkBody(n int64) error {
+	if l.MaxBodyBytes > 0 && n > l.MaxBodyBytes {
+		return fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, l.MaxBodyBytes)
+	}
+	return nil
+}
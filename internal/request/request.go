@@ -13,16 +13,42 @@ import (
 
 type Request struct {
 	RequestLine RequestLine
-	Headers     headers.Headers
-	Body        []byte
+	Headers     *headers.Headers
+	// BodyReader streams the body from the connection as it is read. It must
+	// be read to EOF or closed before the next request on the connection.
+	BodyReader io.ReadCloser
+	// Body holds the whole body once BufferBody has been called. It is nil
+	// for streamed requests.
+	Body []byte
+	// Trailers holds the fields sent in the trailer section of a chunked
+	// body. It is empty for requests without one, and only complete once
+	// the body has been read to EOF.
+	Trailers *headers.Headers
 
+	pathValues map[string]string
+	// bodyErr is the sticky parse error of a streamed body.
+	bodyErr error
+
+	limits         Limits
+	headerOptions  headers.ParseOptions
 	state          requestState
+	sectionBytes   int
+	fieldCount     int
+	contentLength  int
 	bodyLengthRead int
+	chunkRemaining int
+	// onBodyRead is run before the body is first read, see OnBodyRead
+	onBodyRead func() error
+	// pending holds body bytes that have been decoded from the connection
+	// but not yet handed out by BodyReader
+	pending []byte
 }
 
 type RequestLine struct {
-	HttpVersion   string
+	HttpVersion string
+	// RequestTarget is the target as it was sent, Target its parsed form.
 	RequestTarget string
+	Target        Target
 	Method        string
 }
 
@@ -32,49 +58,187 @@ const (
 	requestStateInitialized requestState = iota
 	requestStateParsingHeaders
 	requestStateParsingBody
+	requestStateParsingFixedBody
+	requestStateParsingChunkSize
+	requestStateParsingChunkData
+	requestStateParsingChunkDataEnd
+	requestStateParsingTrailers
 	requestStateDone
 )
 
 const crlf = "\r\n"
 const bufferSize = 8
 
+// maxDiscardBytes is the most body DiscardBody reads just to skip it. Past
+// that, closing the connection is cheaper than draining it.
+const maxDiscardBytes = 256 << 10
+
+// errDiscardTooLarge stops the Reader from draining an unread body larger
+// than maxDiscardBytes.
+var errDiscardTooLarge = errors.New("unread request body too large to discard")
+
+// bodyBufferSize is the least the buffer holds while a body is read, so that
+// bodies are pulled in bulk rather than at the size the header lines needed.
+const bodyBufferSize = 4 << 10
+
+// Reader reads successive requests from a single connection. Bytes read past
+// the end of one request are kept for the next, so pipelined and keep-alive
+// requests are not lost.
+type Reader struct {
+	// Limits applies to every request read after it is set.
+	Limits Limits
+	// HeaderOptions configures parsing of header and trailer fields.
+	HeaderOptions headers.ParseOptions
+
+	reader      io.Reader
+	buf         []byte
+	readToIndex int
+	err         error
+	current     *Request
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		Limits: DefaultLimits,
+		reader: reader,
+		buf:    make([]byte, bufferSize),
+	}
+}
+
+// RequestFromReader reads a single request, buffering its whole body into
+// Request.Body.
 func RequestFromReader(reader io.Reader) (*Request, error) {
-	buf := make([]byte, bufferSize)
-	readToIndex := 0
+	req, err := NewReader(reader).ReadRequest()
+	if err != nil {
+		return nil, err
+	}
+	if err := req.BufferBody(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// ReadRequest parses the request line and headers of the next request and
+// checks how its body is framed. The body itself is left on the connection
+// and pulled on demand through Request.BodyReader; whatever the caller leaves
+// unread is discarded before the following request is parsed. It returns
+// io.EOF if the reader is exhausted before any byte of a new request arrives.
+func (r *Reader) ReadRequest() (*Request, error) {
+	if err := r.DiscardBody(); err != nil {
+		return nil, err
+	}
+
 	req := &Request{
-		state:   requestStateInitialized,
-		Headers: headers.NewHeaders(),
-		Body:    make([]byte, 0),
+		limits:        r.Limits,
+		headerOptions: r.HeaderOptions,
+		state:         requestStateInitialized,
+		Headers:       headers.NewHeaders(),
+		Trailers:      headers.NewHeaders(),
 	}
+	req.BodyReader = &body{req: req, reader: r}
 
-	for req.state != requestStateDone {
-		if readToIndex >= len(buf) {
-			newBuf := make([]byte, len(buf)*2)
-			copy(newBuf, buf)
-			buf = newBuf
+	for req.state <= requestStateParsingBody {
+		if err := r.advance(req); err != nil {
+			return nil, err
 		}
+	}
+	r.current = req
+	return req, nil
+}
 
-		numBytesRead, err := reader.Read(buf[readToIndex:])
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if req.state != requestStateDone {
-					return nil, fmt.Errorf("incomplete request, in state: %d, read n bytes on EOF: %d", req.state, numBytesRead)
-				}
-				break
-			}
-			return nil, err
+// WaitForRequest blocks until at least one byte of the next request has
+// arrived, discarding any unread body of the previous request first. It lets
+// callers tell a connection sitting idle apart from one mid-request.
+func (r *Reader) WaitForRequest() error {
+	if err := r.DiscardBody(); err != nil {
+		return err
+	}
+	for r.readToIndex == 0 {
+		if r.err != nil {
+			return r.err
 		}
-		readToIndex += numBytesRead
+		numBytesRead, err := r.reader.Read(r.buf)
+		r.readToIndex += numBytesRead
+		r.err = err
+	}
+	return nil
+}
 
-		numBytesParsed, err := req.parse(buf[:readToIndex])
-		if err != nil {
-			return nil, err
+// advance parses whatever is buffered into req and, if that makes no
+// progress, reads more from the underlying reader.
+func (r *Reader) advance(req *Request) error {
+	stateBefore := req.state
+	numBytesParsed, err := req.parse(r.buf[:r.readToIndex])
+	if err != nil {
+		return err
+	}
+	copy(r.buf, r.buf[numBytesParsed:r.readToIndex])
+	r.readToIndex -= numBytesParsed
+
+	if numBytesParsed > 0 || req.state != stateBefore || req.state == requestStateDone {
+		return nil
+	}
+
+	if r.err != nil {
+		if errors.Is(r.err, io.EOF) {
+			if req.state == requestStateInitialized && r.readToIndex == 0 {
+				return io.EOF
+			}
+			return &ParseError{Section: req.state.section(), Version: req.RequestLine.HttpVersion, Err: ErrUnexpectedEOF}
 		}
+		return r.err
+	}
 
-		copy(buf, buf[numBytesParsed:])
-		readToIndex -= numBytesParsed
+	size := len(r.buf)
+	if r.readToIndex >= size {
+		size *= 2
 	}
-	return req, nil
+	if req.state >= requestStateParsingBody && size < bodyBufferSize {
+		size = bodyBufferSize
+	}
+	if size > len(r.buf) {
+		newBuf := make([]byte, size)
+		copy(newBuf, r.buf[:r.readToIndex])
+		r.buf = newBuf
+	}
+
+	numBytesRead, err := r.reader.Read(r.buf[r.readToIndex:])
+	r.readToIndex += numBytesRead
+	r.err = err
+	return nil
+}
+
+// DiscardBody skips whatever the caller left unread of the most recent
+// request's body, leaving the Reader positioned at the next request. It fails
+// if the request has an OnBodyRead hook that never ran, since the client may
+// be withholding the body until it hears 100 Continue, and if more than 256
+// KiB of body is left, which is not worth reading just to reuse the
+// connection.
+func (r *Reader) DiscardBody() error {
+	req := r.current
+	if req == nil {
+		return nil
+	}
+	if req.BodyWithheld() {
+		return errBodyWithheld
+	}
+	if req.BodyTooLargeToDiscard() {
+		return errDiscardTooLarge
+	}
+	discarded := 0
+	for req.state != requestStateDone {
+		discarded += len(req.pending)
+		if discarded > maxDiscardBytes {
+			return errDiscardTooLarge
+		}
+		req.pending = req.pending[:0]
+		if err := r.advance(req); err != nil {
+			return err
+		}
+	}
+	req.pending = nil
+	r.current = nil
+	return nil
 }
 
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
@@ -94,35 +258,43 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 func requestLineFromString(str string) (*RequestLine, error) {
 	parts := strings.Split(str, " ")
 	if len(parts) != 3 {
-		return nil, fmt.Errorf("poorly formatted request-line: %s", str)
+		return nil, fmt.Errorf("%w: %q", ErrMalformedRequestLine, str)
 	}
 
 	method := parts[0]
 	for _, c := range method {
 		if c < 'A' || c > 'Z' {
-			return nil, fmt.Errorf("invalid method: %s", method)
+			return nil, fmt.Errorf("%w: %q", ErrInvalidMethod, method)
 		}
 	}
 
 	requestTarget := parts[1]
+	target, err := parseTarget(method, requestTarget)
+	if err != nil {
+		return nil, err
+	}
 
 	versionParts := strings.Split(parts[2], "/")
 	if len(versionParts) != 2 {
-		return nil, fmt.Errorf("malformed start-line: %s", str)
+		return nil, fmt.Errorf("%w: %q", ErrMalformedRequestLine, str)
 	}
 
 	httpPart := versionParts[0]
 	if httpPart != "HTTP" {
-		return nil, fmt.Errorf("unrecognized HTTP-version: %s", httpPart)
+		return nil, fmt.Errorf("%w: unrecognized protocol %q", ErrMalformedRequestLine, httpPart)
 	}
 	version := versionParts[1]
-	if version != "1.1" {
-		return nil, fmt.Errorf("unrecognized HTTP-version: %s", version)
+	if len(version) != 3 || !isDigit(version[0]) || version[1] != '.' || !isDigit(version[2]) {
+		return nil, fmt.Errorf("%w: malformed HTTP-version %q", ErrMalformedRequestLine, parts[2])
+	}
+	if version != "1.1" && version != "1.0" {
+		return nil, fmt.Errorf("%w: HTTP/%s", ErrUnsupportedVersion, version)
 	}
 
 	return &RequestLine{
 		Method:        method,
 		RequestTarget: requestTarget,
+		Target:        target,
 		HttpVersion:   versionParts[1],
 	}, nil
 }
@@ -132,7 +304,7 @@ func (r *Request) parse(data []byte) (int, error) {
 	for r.state != requestStateDone {
 		n, err := r.parseSingle(data[totalBytesParsed:])
 		if err != nil {
-			return 0, err
+			return 0, &ParseError{Section: r.state.section(), Version: r.RequestLine.HttpVersion, Err: err}
 		}
 		totalBytesParsed += n
 		if n == 0 {
@@ -145,6 +317,14 @@ func (r *Request) parse(data []byte) (int, error) {
 func (r *Request) parseSingle(data []byte) (int, error) {
 	switch r.state {
 	case requestStateInitialized:
+		if bytes.HasPrefix(data, []byte(crlf)) {
+			// RFC 9112 section 2.2: empty lines before the request line,
+			// such as a stray CRLF after a previous body, are ignored
+			return len(crlf), nil
+		}
+		if err := r.limits.checkRequestLine(data); err != nil {
+			return 0, err
+		}
 		requestLine, n, err := parseRequestLine(data)
 		if err != nil {
 			return 0, err
@@ -156,38 +336,195 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 		r.state = requestStateParsingHeaders
 		return n, nil
 	case requestStateParsingHeaders:
-		n, done, err := r.Headers.Parse(data)
+		n, done, err := r.parseField(r.Headers, data)
 		if err != nil {
 			return 0, err
 		}
 		if done {
+			if err := r.checkHost(); err != nil {
+				return 0, err
+			}
+			if err := r.checkExpect(); err != nil {
+				return 0, err
+			}
 			r.state = requestStateParsingBody
 		}
 		return n, nil
 	case requestStateParsingBody:
-		contentLenStr, ok := r.Headers.Get("content-length")
-		if !ok {
+		chunked, contentLen, err := r.bodyFraming()
+		if err != nil {
+			return 0, err
+		}
+		if chunked {
+			r.state = requestStateParsingChunkSize
+			return 0, nil
+		}
+		if err := r.limits.checkBody(contentLen); err != nil {
+			return 0, err
+		}
+		r.contentLength = int(contentLen)
+		r.state = requestStateParsingFixedBody
+		if contentLen == 0 {
 			r.state = requestStateDone
-			return len(data), nil
 		}
-		contentLen, err := strconv.Atoi(contentLenStr)
+		return 0, nil
+	case requestStateParsingFixedBody:
+		// only consume this request's body; anything after it belongs to the
+		// next request on the connection
+		n := min(len(data), r.contentLength-r.bodyLengthRead)
+		r.pending = append(r.pending, data[:n]...)
+		r.bodyLengthRead += n
+
+		if r.bodyLengthRead == r.contentLength {
+			r.state = requestStateDone
+		}
+		return n, nil
+	case requestStateParsingChunkSize:
+		idx := bytes.Index(data, []byte(crlf))
+		if exceeds(idx, r.limits.MaxHeaderLineBytes) || (idx == -1 && exceeds(len(data), r.limits.MaxHeaderLineBytes)) {
+			return 0, fmt.Errorf("%w: chunk size line too long", ErrMalformedChunk)
+		}
+		if idx == -1 {
+			return 0, nil
+		}
+		size, err := parseChunkSize(data[:idx])
 		if err != nil {
-			return 0, fmt.Errorf("malformed Content-Length: %s", err)
+			return 0, err
 		}
-
-		r.Body = append(r.Body, data...)
-		r.bodyLengthRead += len(data)
-
-		if r.bodyLengthRead > contentLen {
-			return 0, fmt.Errorf("Content-Length too large")
+		if size == 0 {
+			r.state = requestStateParsingTrailers
+		} else {
+			if err := r.limits.checkBody(int64(r.bodyLengthRead) + int64(size)); err != nil {
+				return 0, err
+			}
+			r.chunkRemaining = size
+			r.state = requestStateParsingChunkData
+		}
+		return idx + 2, nil
+	case requestStateParsingChunkData:
+		n := min(len(data), r.chunkRemaining)
+		r.pending = append(r.pending, data[:n]...)
+		r.bodyLengthRead += n
+		r.chunkRemaining -= n
+		if r.chunkRemaining == 0 {
+			r.state = requestStateParsingChunkDataEnd
+		}
+		return n, nil
+	case requestStateParsingChunkDataEnd:
+		if len(data) < 2 {
+			return 0, nil
 		}
-		if r.bodyLengthRead == contentLen {
+		if !bytes.HasPrefix(data, []byte(crlf)) {
+			return 0, fmt.Errorf("%w: missing CRLF after chunk data", ErrMalformedChunk)
+		}
+		r.state = requestStateParsingChunkSize
+		return 2, nil
+	case requestStateParsingTrailers:
+		n, done, err := r.parseField(r.Trailers, data)
+		if err != nil {
+			return 0, err
+		}
+		if done {
 			r.state = requestStateDone
 		}
-		return len(data), nil
+		return n, nil
 	case requestStateDone:
 		return 0, fmt.Errorf("error: trying to read data in a done state")
 	default:
 		return 0, fmt.Errorf("error: invalid state")
 	}
 }
+
+// parseField parses one header or trailer line into h, enforcing the header
+// limits on the section it belongs to.
+func (r *Request) parseField(h *headers.Headers, data []byte) (int, bool, error) {
+	if err := r.limits.checkFieldLine(data, r.sectionBytes, r.fieldCount); err != nil {
+		return 0, false, err
+	}
+	if r.fieldCount == 0 && len(data) > 0 && (data[0] == ' ' || data[0] == '\t') {
+		// RFC 9112 section 2.2: whitespace before the first field line
+		// could smuggle a field past a lenient intermediary
+		return 0, false, fmt.Errorf("%w: whitespace before the first field line", headers.ErrInvalidFieldName)
+	}
+	n, done, err := h.ParseWith(data, r.headerOptions)
+	if err != nil {
+		return 0, false, err
+	}
+	r.sectionBytes += n
+	if n > 0 && !done {
+		r.fieldCount++
+	}
+	if done {
+		// the trailer section is limited on its own
+		r.sectionBytes = 0
+		r.fieldCount = 0
+	}
+	return n, done, nil
+}
+
+// parseChunkSize parses a chunk-size line (without its CRLF), ignoring any
+// chunk extensions after the size.
+func parseChunkSize(line []byte) (int, error) {
+	sizePart, ext, hasExt := bytes.Cut(line, []byte(";"))
+	if hasExt {
+		// RFC 9112 section 7.1.1 allows whitespace only before an extension
+		sizePart = bytes.TrimRight(sizePart, " \t")
+	}
+	if len(sizePart) == 0 || len(sizePart) > 15 {
+		return 0, fmt.Errorf("%w: bad chunk size %q", ErrMalformedChunk, line)
+	}
+	for _, c := range sizePart {
+		if !isHexDigit(c) {
+			return 0, fmt.Errorf("%w: bad chunk size %q", ErrMalformedChunk, line)
+		}
+	}
+	if err := validateChunkExtensions(ext); err != nil {
+		return 0, err
+	}
+	size, err := strconv.ParseInt(string(sizePart), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad chunk size %q", ErrMalformedChunk, line)
+	}
+	return int(size), nil
+}
+
+func validateChunkExtensions(ext []byte) error {
+	if len(ext) == 0 {
+		return nil
+	}
+	for _, e := range bytes.Split(ext, []byte(";")) {
+		name, _, _ := bytes.Cut(e, []byte("="))
+		name = bytes.Trim(name, " \t")
+		if len(name) == 0 {
+			return fmt.Errorf("%w: bad chunk extension %q", ErrMalformedChunk, ext)
+		}
+		for _, c := range name {
+			if c <= ' ' || c >= 0x7f || bytes.IndexByte([]byte(`"(),/:;<=>?@[\]{}`), c) != -1 {
+				return fmt.Errorf("%w: bad chunk extension %q", ErrMalformedChunk, ext)
+			}
+		}
+	}
+	return nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// PathValue returns the value a router captured for the named path
+// parameter, or "" if there is none.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
+
+// SetPathValue records a path parameter captured while routing the request.
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathValues == nil {
+		r.pathValues = map[string]string{}
+	}
+	r.pathValues[name] = value
+}
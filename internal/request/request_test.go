@@ -2,8 +2,10 @@ package request
 
 import (
 	"io"
+	"strings"
 	"testing"
 
+	"github.com/jacobdanielrose/httpfromtcp/internal/headers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -45,6 +47,15 @@ func TestRequestLineParse(t *testing.T) {
 	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
 	assert.Equal(t, "1.1", r.RequestLine.HttpVersion)
 
+	// Test: Empty lines before the request line are ignored
+	reader = &chunkReader{
+		data:            "\r\n\r\nGET /coffee HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "/coffee", r.RequestLine.RequestTarget)
+
 	// Test: Invalid number of parts in request line
 	reader = &chunkReader{
 		data:            "/coffee HTTP/1.1\r\nHost: localhost:42069\r\nUser-Agent: curl/7.81.0\r\nAccept: */*\r\n\r\n",
@@ -79,19 +90,27 @@ func TestHeadersParse(t *testing.T) {
 	r, err := RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
-	assert.Equal(t, "*/*", r.Headers["accept"])
+	assert.Equal(t, "localhost:42069", headerValue(r, "host"))
+	assert.Equal(t, "curl/7.81.0", headerValue(r, "user-agent"))
+	assert.Equal(t, "*/*", headerValue(r, "accept"))
 
 	// Test: Empty Headers
 	reader = &chunkReader{
-		data:            "GET / HTTP/1.1\r\n\r\n",
+		data:            "GET / HTTP/1.0\r\n\r\n",
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Empty(t, r.Headers)
+	assert.Equal(t, 0, r.Headers.Len())
+
+	// Test: HTTP/1.1 requires Host
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrMissingHost)
 
 	// Test: Malformed Header
 	reader = &chunkReader{
@@ -107,9 +126,17 @@ func TestHeadersParse(t *testing.T) {
 		numBytesPerRead: 3,
 	}
 	r, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrDuplicateHost)
+
+	// Test: Duplicate Headers other than Host are combined
+	reader = &chunkReader{
+		data:            "GET / HTTP/1.1\r\nHost: localhost:42069\r\nAccept: text/html\r\nAccept: */*\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069, duplicate:8080", r.Headers["host"])
+	assert.Equal(t, "text/html, */*", headerValue(r, "accept"))
 
 	// Test: Case Insensitive Headers
 	reader = &chunkReader{
@@ -119,8 +146,8 @@ func TestHeadersParse(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.NoError(t, err)
 	require.NotNil(t, r)
-	assert.Equal(t, "localhost:42069", r.Headers["host"])
-	assert.Equal(t, "curl/7.81.0", r.Headers["user-agent"])
+	assert.Equal(t, "localhost:42069", headerValue(r, "host"))
+	assert.Equal(t, "curl/7.81.0", headerValue(r, "user-agent"))
 
 	// Test: Missing End of Headers
 	reader = &chunkReader{
@@ -198,13 +225,587 @@ func TestBodyParse(t *testing.T) {
 
 }
 
+func TestChunkedBodyParse(t *testing.T) {
+	// Test: Standard chunked body
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"6\r\nhello \r\n" +
+			"7\r\nworld!\n\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+	assert.Equal(t, 0, r.Trailers.Len())
+
+	// Test: Chunk extensions and trailers
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"A;name=value\r\n0123456789\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "0123456789", string(r.Body))
+	checksum, ok := r.Trailers.Get("X-Checksum")
+	assert.True(t, ok)
+	assert.Equal(t, "abc", checksum)
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Whitespace after the chunk size only before an extension
+	chunked := func(body string) error {
+		_, err := RequestFromReader(&chunkReader{
+			data: "POST /submit HTTP/1.1\r\n" +
+				"Host: localhost:42069\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" + body,
+			numBytesPerRead: 3,
+		})
+		return err
+	}
+	require.ErrorIs(t, chunked("5 \r\nhello\r\n0\r\n\r\n"), ErrMalformedChunk)
+	require.ErrorIs(t, chunked("5\t\r\nhello\r\n0\r\n\r\n"), ErrMalformedChunk)
+	require.NoError(t, chunked("5 ;a=b\r\nhello\r\n0\r\n\r\n"))
+
+	// Test: Chunk longer than its size
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"3\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Missing last chunk
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestReadMultipleRequests(t *testing.T) {
+	// Test: Pipelined requests on one connection
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello" +
+			"GET /next HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 7,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/submit", r.RequestLine.RequestTarget)
+	body, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "GET", r.RequestLine.Method)
+	assert.Equal(t, "/next", r.RequestLine.RequestTarget)
+
+	// Test: Clean EOF between requests
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Unread body is skipped before the next request
+	reader = NewReader(&chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"5\r\nhello\r\n" +
+			"0\r\n" +
+			"\r\n" +
+			"GET /after HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	})
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/upload", r.RequestLine.RequestTarget)
+	require.NoError(t, r.BodyReader.Close())
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/after", r.RequestLine.RequestTarget)
+
+	// Test: Large unread body is not drained
+	large := &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 1048576\r\n" +
+			"\r\n" +
+			strings.Repeat("x", 1<<20),
+		numBytesPerRead: 1 << 10,
+	}
+	reader = NewReader(large)
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.True(t, r.BodyTooLargeToDiscard())
+	require.Error(t, reader.DiscardBody())
+	assert.Less(t, large.pos, 1<<10)
+
+	// Test: Large chunked body is drained only up to the cap
+	large = &chunkReader{
+		data: "POST /upload HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			strings.Repeat("400\r\n"+strings.Repeat("x", 1<<10)+"\r\n", 1<<10) +
+			"0\r\n\r\n",
+		numBytesPerRead: 1 << 10,
+	}
+	reader = NewReader(large)
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.False(t, r.BodyTooLargeToDiscard())
+	require.Error(t, reader.DiscardBody())
+	assert.Less(t, large.pos, 512<<10)
+}
+
+func TestStreamingBody(t *testing.T) {
+	// Test: Body is available incrementally after the headers
+	reader := NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Nil(t, r.Body)
+	buf := make([]byte, 5)
+	n, err := io.ReadFull(r.BodyReader, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	rest, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, " world!\n", string(rest))
+
+	// Test: Body is read in bulk, not at the header buffer's size
+	large := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 65536\r\n" +
+			"\r\n" +
+			strings.Repeat("x", 65536),
+		numBytesPerRead: 1 << 20,
+	}
+	reader = NewReader(large)
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	rest, err = io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Len(t, rest, 65536)
+	assert.Less(t, large.reads, 32)
+
+	// Test: Truncated body surfaces as a read error
+	reader = NewReader(&chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Host: localhost:42069\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial content\n",
+		numBytesPerRead: 3,
+	})
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.BodyReader)
+	require.Error(t, err)
+}
+
+func TestLimits(t *testing.T) {
+	limits := Limits{
+		MaxRequestLineBytes: 20,
+		MaxHeaderLineBytes:  30,
+		MaxHeaderBytes:      50,
+		MaxHeaderCount:      3,
+		MaxBodyBytes:        10,
+	}
+	read := func(data string) (*Request, error) {
+		reader := NewReader(&chunkReader{data: data, numBytesPerRead: 3})
+		reader.Limits = limits
+		return reader.ReadRequest()
+	}
+
+	// Test: Within every limit
+	_, err := read("GET / HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 10\r\n\r\n")
+	require.NoError(t, err)
+
+	// Test: Request line too long, even before its CRLF arrives
+	_, err = read("GET /a/very/long/path/indeed HTTP/1.1\r\n\r\n")
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+	_, err = read("GET /a/very/long/path/without/end")
+	require.ErrorIs(t, err, ErrRequestLineTooLong)
+
+	// Test: Single header line too long
+	_, err = read("GET / HTTP/1.1\r\nX-Long: aaaaaaaaaaaaaaaaaaaaaaaaaaaaaa\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Header section too large
+	_, err = read("GET / HTTP/1.1\r\nX-A: aaaaaaaaaaaaaaa\r\nX-B: bbbbbbbbbbbbbbb\r\nX-C: ccc\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Too many header fields
+	_, err = read("GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n")
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Declared body too large is rejected with the headers
+	_, err = read("POST / HTTP/1.1\r\nHost: h\r\nContent-Length: 11\r\n\r\n")
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// Test: Chunked body grows too large while being read
+	r, err := read("POST / HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: chunked\r\n\r\n8\r\n12345678\r\n8\r\n12345678\r\n0\r\n\r\n")
+	require.NoError(t, err)
+	_, err = io.ReadAll(r.BodyReader)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestMessageLengthRules(t *testing.T) {
+	read := func(framing string) (*Request, error) {
+		return RequestFromReader(&chunkReader{
+			data:            "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\n" + framing + "\r\nhello",
+			numBytesPerRead: 3,
+		})
+	}
+
+	// Test: Repeated identical Content-Length is one length
+	r, err := read("Content-Length: 5\r\nContent-Length: 5\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	r, err = read("Content-Length: 5, 5\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Conflicting Content-Length
+	_, err = read("Content-Length: 5\r\nContent-Length: 6\r\n")
+	require.ErrorIs(t, err, ErrConflictingContentLength)
+	_, err = read("Content-Length: 5, 4\r\n")
+	require.ErrorIs(t, err, ErrConflictingContentLength)
+
+	// Test: Signed, hex, empty and oversized lengths
+	for _, cl := range []string{"+5", "-5", "0x5", "", "5 5", "99999999999999999999"} {
+		_, err = read("Content-Length: " + cl + "\r\n")
+		require.ErrorIs(t, err, ErrInvalidContentLength, cl)
+	}
+
+	// Test: Content-Length together with Transfer-Encoding
+	_, err = read("Content-Length: 5\r\nTransfer-Encoding: chunked\r\n")
+	require.ErrorIs(t, err, ErrContentLengthWithTransferEncoding)
+
+	// Test: chunked must be the final coding, applied once
+	_, err = read("Transfer-Encoding: chunked, gzip\r\n")
+	require.ErrorIs(t, err, ErrChunkedNotFinal)
+	_, err = read("Transfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n")
+	require.ErrorIs(t, err, ErrChunkedNotFinal)
+
+	// Test: Other codings cannot be decoded
+	_, err = read("Transfer-Encoding: gzip, chunked\r\n")
+	require.ErrorIs(t, err, ErrUnsupportedTransferEncoding)
+}
+
+func TestParseErrors(t *testing.T) {
+	read := func(data string) error {
+		_, err := RequestFromReader(&chunkReader{data: data, numBytesPerRead: 3})
+		return err
+	}
+
+	// Test: Request line errors
+	err := read("GET /coffee\r\n\r\n")
+	require.ErrorIs(t, err, ErrMalformedRequestLine)
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, "request line", parseErr.Section)
+	assert.Empty(t, parseErr.Version)
+
+	require.ErrorIs(t, read("get / HTTP/1.1\r\n\r\n"), ErrInvalidMethod)
+	require.ErrorIs(t, read("GET / TCP/1.1\r\n\r\n"), ErrMalformedRequestLine)
+	require.ErrorIs(t, read("GET / HTTP/one\r\n\r\n"), ErrMalformedRequestLine)
+	require.ErrorIs(t, read("GET / HTTP/2.0\r\n\r\n"), ErrUnsupportedVersion)
+
+	// Test: Header errors come from the headers package
+	err = read("GET / HTTP/1.1\r\nH@st: localhost\r\n\r\n")
+	require.ErrorIs(t, err, headers.ErrInvalidFieldName)
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, "headers", parseErr.Section)
+	assert.Equal(t, "1.1", parseErr.Version)
+
+	// Test: Whitespace before the first field line
+	require.ErrorIs(t, read("GET / HTTP/1.1\r\n Host: evil\r\n\r\n"), headers.ErrInvalidFieldName)
+	require.ErrorIs(t, read("POST / HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\tX-Sum: 1\r\n\r\n"), headers.ErrInvalidFieldName)
+
+	// Test: Malformed chunk
+	err = read("POST / HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: chunked\r\n\r\n-1\r\n\r\n")
+	require.ErrorIs(t, err, ErrMalformedChunk)
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, "body", parseErr.Section)
+
+	// Test: Connection closed partway through
+	err = read("GET / HTTP/1.1\r\nHost: localhost")
+	require.ErrorIs(t, err, ErrUnexpectedEOF)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	err = read("POST / HTTP/1.1\r\nHost: h\r\nContent-Length: 10\r\n\r\nhello")
+	require.ErrorIs(t, err, ErrUnexpectedEOF)
+}
+
+func TestHTTP10(t *testing.T) {
+	// Test: HTTP/1.0 request line
+	r, err := RequestFromReader(&chunkReader{
+		data:            "GET /old HTTP/1.0\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.RequestLine.HttpVersion)
+
+	// Test: HTTP/1.0 body delimited by Content-Length
+	r, err = RequestFromReader(&chunkReader{
+		data:            "POST /old HTTP/1.0\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+
+	// Test: Transfer-Encoding is not part of HTTP/1.0
+	_, err = RequestFromReader(&chunkReader{
+		data:            "POST /old HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrTransferEncodingHTTP10)
+}
+
+func TestRequestTarget(t *testing.T) {
+	parse := func(method, target string) (Target, error) {
+		r, err := RequestFromReader(&chunkReader{
+			data:            method + " " + target + " HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+			numBytesPerRead: 3,
+		})
+		if err != nil {
+			return Target{}, err
+		}
+		return r.RequestLine.Target, nil
+	}
+
+	// Test: Origin form with decoded path and query
+	target, err := parse("GET", "/files/a%20b%2Fc?q=go+lang&tag=x&tag=y&flag")
+	require.NoError(t, err)
+	assert.Equal(t, FormOrigin, target.Form)
+	assert.Equal(t, "/files/a b/c", target.Path)
+	assert.Equal(t, "/files/a%20b%2Fc", target.RawPath)
+	assert.Equal(t, "q=go+lang&tag=x&tag=y&flag", target.RawQuery)
+	assert.Equal(t, "go lang", target.Query.Get("q"))
+	assert.Equal(t, []string{"x", "y"}, target.Query["tag"])
+	assert.True(t, target.Query.Has("flag"))
+
+	// Test: Absolute form
+	target, err = parse("GET", "http://example.com:8080/a?b=c")
+	require.NoError(t, err)
+	assert.Equal(t, FormAbsolute, target.Form)
+	assert.Equal(t, "http", target.Scheme)
+	assert.Equal(t, "example.com:8080", target.Host)
+	assert.Equal(t, "/a", target.Path)
+	assert.Equal(t, "c", target.Query.Get("b"))
+	target, err = parse("GET", "http://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "/", target.Path)
+
+	// Test: Authority form for CONNECT
+	target, err = parse("CONNECT", "example.com:443")
+	require.NoError(t, err)
+	assert.Equal(t, FormAuthority, target.Form)
+	assert.Equal(t, "example.com:443", target.Host)
+	target, err = parse("CONNECT", "[::1]:443")
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:443", target.Host)
+	_, err = parse("CONNECT", "/path")
+	require.ErrorIs(t, err, ErrInvalidTarget)
+	_, err = parse("CONNECT", "example.com")
+	require.ErrorIs(t, err, ErrInvalidTarget)
+
+	// Test: Asterisk form only for OPTIONS
+	target, err = parse("OPTIONS", "*")
+	require.NoError(t, err)
+	assert.Equal(t, FormAsterisk, target.Form)
+	_, err = parse("GET", "*")
+	require.ErrorIs(t, err, ErrInvalidTarget)
+
+	// Test: Invalid targets
+	for _, bad := range []string{"/a%2", "/a%zz", "/?q=%G1", "/a#frag", "/a\"b", "coffee", "http://user@host/", "http:///a"} {
+		_, err = parse("GET", bad)
+		require.ErrorIs(t, err, ErrInvalidTarget, bad)
+	}
+}
+
+func TestHost(t *testing.T) {
+	read := func(data string) (*Request, error) {
+		return RequestFromReader(&chunkReader{data: data, numBytesPerRead: 3})
+	}
+
+	// Test: Host from the header
+	r, err := read("GET / HTTP/1.1\r\nHost: Example.com:8080\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "Example.com:8080", r.Host())
+
+	// Test: Absolute-form target overrides the header
+	r, err = read("GET http://example.org/a HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "example.org", r.Host())
+
+	// Test: HTTP/1.0 may omit Host
+	r, err = read("GET / HTTP/1.0\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "", r.Host())
+
+	// Test: Empty Host is allowed only without an authority in the target
+	_, err = read("GET / HTTP/1.1\r\nHost:\r\n\r\n")
+	require.NoError(t, err)
+	_, err = read("GET http://example.com/ HTTP/1.1\r\nHost:\r\n\r\n")
+	require.ErrorIs(t, err, ErrInvalidHost)
+	_, err = read("CONNECT example.com:443 HTTP/1.1\r\nHost:\r\n\r\n")
+	require.ErrorIs(t, err, ErrInvalidHost)
+
+	// Test: Brackets only enclose a leading IPv6 address
+	r, err = read("GET / HTTP/1.1\r\nHost: [::1]:8080\r\n\r\n")
+	require.NoError(t, err)
+	assert.Equal(t, "[::1]:8080", r.Host())
+	for _, host := range []string{"a]b[", "[::1", "[::1]x", "[example.com]", "a[::1]"} {
+		_, err = read("GET / HTTP/1.1\r\nHost: " + host + "\r\n\r\n")
+		require.ErrorIs(t, err, ErrInvalidHost, host)
+	}
+
+	// Test: Host listing several hosts
+	_, err = read("GET / HTTP/1.1\r\nHost: a.com, b.com\r\n\r\n")
+	require.ErrorIs(t, err, ErrDuplicateHost)
+
+	// Test: Invalid Host
+	_, err = read("GET / HTTP/1.1\r\nHost: user@example.com\r\n\r\n")
+	require.ErrorIs(t, err, ErrInvalidHost)
+	var parseErr *ParseError
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, "headers", parseErr.Section)
+	assert.Equal(t, "1.1", parseErr.Version)
+}
+
+func TestExpectContinue(t *testing.T) {
+	// Test: Hook runs once before the body is first read
+	reader := NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\nhello",
+		numBytesPerRead: 3,
+	})
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.True(t, r.ExpectsContinue())
+	calls := 0
+	r.OnBodyRead(func() error {
+		calls++
+		return nil
+	})
+	data, err := io.ReadAll(r.BodyReader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.Equal(t, 1, calls)
+	assert.False(t, r.BodyWithheld())
+
+	// Test: Unread body is not waited for while the hook is pending
+	reader = NewReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	r.OnBodyRead(func() error { return nil })
+	assert.True(t, r.BodyWithheld())
+	require.Error(t, reader.DiscardBody())
+
+	// Test: HTTP/1.0 clients cannot expect 100 Continue
+	r, err = RequestFromReader(&chunkReader{
+		data:            "POST / HTTP/1.0\r\nExpect: 100-continue\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.NoError(t, err)
+	assert.False(t, r.ExpectsContinue())
+
+	// Test: Unknown expectation
+	_, err = RequestFromReader(&chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: 200-ok\r\n\r\n",
+		numBytesPerRead: 3,
+	})
+	require.ErrorIs(t, err, ErrUnsupportedExpectation)
+}
+
+func TestHeaderParseOptions(t *testing.T) {
+	data := "GET / HTTP/1.1\r\nHost: localhost:42069\r\nX-Folded: a\r\n b\r\n\r\n"
+
+	// Test: Obs-fold rejected by default
+	_, err := RequestFromReader(&chunkReader{data: data, numBytesPerRead: 3})
+	require.ErrorIs(t, err, headers.ErrObsFold)
+
+	// Test: Obs-fold unfolded when configured
+	reader := NewReader(&chunkReader{data: data, numBytesPerRead: 3})
+	reader.HeaderOptions = headers.ParseOptions{UnfoldObsFold: true}
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "a b", headerValue(r, "x-folded"))
+}
+
+func headerValue(r *Request, key string) string {
+	v, _ := r.Headers.Get(key)
+	return v
+}
+
 type chunkReader struct {
 	data            string
 	numBytesPerRead int
 	pos             int
+	reads           int
 }
 
 func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	cr.reads++
 	if cr.pos >= len(cr.data) {
 		return 0, io.EOF
 	}
@@ -0,0 +1,236 @@
+package request
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidTarget means the request-target is not in a form allowed for the
+// method, contains characters a URI cannot, or has bad percent-encoding.
+var ErrInvalidTarget = errors.New("invalid request target")
+
+// TargetForm is one of the four request-target forms of RFC 9112 section 3.2.
+type TargetForm int
+
+const (
+	// FormOrigin is an absolute path with an optional query: "/a/b?c=d".
+	FormOrigin TargetForm = iota
+	// FormAbsolute is a full URI, sent to proxies: "http://host/a?c=d".
+	FormAbsolute
+	// FormAuthority is "host:port", used only by CONNECT.
+	FormAuthority
+	// FormAsterisk is "*", used only by a server-wide OPTIONS.
+	FormAsterisk
+)
+
+// Target is a parsed request-target.
+type Target struct {
+	Form TargetForm
+	// Scheme is set for the absolute form only.
+	Scheme string
+	// Host is the authority of the absolute and authority forms, including
+	// any port.
+	Host string
+	// Path is the percent-decoded path, RawPath the path as it was sent.
+	// Both are empty for the authority and asterisk forms.
+	Path    string
+	RawPath string
+	// RawQuery is the query without its "?", Query its decoded parameters.
+	RawQuery string
+	Query    url.Values
+}
+
+// parseTarget parses the request-target of a request with the given method.
+func parseTarget(method, raw string) (Target, error) {
+	switch {
+	case method == "CONNECT":
+		return parseAuthorityForm(raw)
+	case raw == "*":
+		if method != "OPTIONS" {
+			return Target{}, fmt.Errorf("%w: %q is only allowed for OPTIONS", ErrInvalidTarget, raw)
+		}
+		return Target{Form: FormAsterisk, Query: url.Values{}}, nil
+	case strings.HasPrefix(raw, "/"):
+		return parseOriginForm(FormOrigin, raw)
+	}
+
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok || !validScheme(scheme) {
+		return Target{}, fmt.Errorf("%w: %q", ErrInvalidTarget, raw)
+	}
+	host, pathQuery := rest, "/"
+	if i := strings.IndexAny(rest, "/?"); i >= 0 {
+		host, pathQuery = rest[:i], rest[i:]
+		if !strings.HasPrefix(pathQuery, "/") {
+			pathQuery = "/" + pathQuery
+		}
+	}
+	if !validHost(host) {
+		return Target{}, fmt.Errorf("%w: bad authority in %q", ErrInvalidTarget, raw)
+	}
+	target, err := parseOriginForm(FormAbsolute, pathQuery)
+	if err != nil {
+		return Target{}, err
+	}
+	target.Scheme = strings.ToLower(scheme)
+	target.Host = host
+	return target, nil
+}
+
+func parseAuthorityForm(raw string) (Target, error) {
+	host, port, ok := strings.Cut(raw, ":")
+	if strings.HasPrefix(raw, "[") {
+		// IPv6 literal
+		end := strings.Index(raw, "]")
+		if end < 0 {
+			return Target{}, fmt.Errorf("%w: %q", ErrInvalidTarget, raw)
+		}
+		host = raw[:end+1]
+		port, ok = strings.CutPrefix(raw[end+1:], ":")
+	}
+	if !ok || host == "" || port == "" || !validHost(raw) {
+		return Target{}, fmt.Errorf("%w: CONNECT needs host:port, got %q", ErrInvalidTarget, raw)
+	}
+	for i := range len(port) {
+		if !isDigit(port[i]) {
+			return Target{}, fmt.Errorf("%w: bad port in %q", ErrInvalidTarget, raw)
+		}
+	}
+	return Target{Form: FormAuthority, Host: raw, Query: url.Values{}}, nil
+}
+
+func parseOriginForm(form TargetForm, raw string) (Target, error) {
+	rawPath, rawQuery, _ := strings.Cut(raw, "?")
+	for i := range len(raw) {
+		c := raw[i]
+		if !isPathChar(c) && !(i >= len(rawPath) && c == '?') {
+			return Target{}, fmt.Errorf("%w: unexpected character %q in %q", ErrInvalidTarget, c, raw)
+		}
+	}
+	path, err := unescape(rawPath, false)
+	if err != nil {
+		return Target{}, err
+	}
+	query, err := parseQuery(rawQuery)
+	if err != nil {
+		return Target{}, err
+	}
+	return Target{
+		Form:     form,
+		Path:     path,
+		RawPath:  rawPath,
+		RawQuery: rawQuery,
+		Query:    query,
+	}, nil
+}
+
+// parseQuery decodes "a=1&b=2&a=3"; a parameter without "=" has an empty
+// value and empty parameters are skipped.
+func parseQuery(raw string) (url.Values, error) {
+	query := url.Values{}
+	for param := range strings.SplitSeq(raw, "&") {
+		if param == "" {
+			continue
+		}
+		rawKey, rawValue, _ := strings.Cut(param, "=")
+		key, err := unescape(rawKey, true)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unescape(rawValue, true)
+		if err != nil {
+			return nil, err
+		}
+		query.Add(key, value)
+	}
+	return query, nil
+}
+
+// unescape decodes percent-encoding, and "+" as a space if plusIsSpace is
+// set, as in query strings.
+func unescape(s string, plusIsSpace bool) (string, error) {
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '%':
+			if i+2 >= len(s) || !isHexDigit(s[i+1]) || !isHexDigit(s[i+2]) {
+				return "", fmt.Errorf("%w: bad percent-encoding in %q", ErrInvalidTarget, s)
+			}
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		case s[i] == '+' && plusIsSpace:
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	default:
+		return c - '0'
+	}
+}
+
+// isPathChar reports whether c may appear in a path or query: pchar and "/"
+// from RFC 3986, with "%" checked separately by unescape.
+func isPathChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', isDigit(c):
+		return true
+	}
+	return strings.IndexByte("-._~!$&'()*+,;=:@/%", c) >= 0
+}
+
+// validScheme checks ALPHA *( ALPHA / DIGIT / "+" / "-" / "." ).
+func validScheme(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := range len(s) {
+		c := s[i]
+		letter := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+		if !letter && (i == 0 || !isDigit(c) && c != '+' && c != '-' && c != '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// validHost checks that an authority is non-empty and made of characters a
+// host and port can contain, with brackets only around a leading IPv6
+// address. User info is not allowed in a request-target.
+func validHost(s string) bool {
+	if s == "" {
+		return false
+	}
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 || !strings.Contains(s[1:end], ":") || net.ParseIP(s[1:end]) == nil {
+			return false
+		}
+		s = s[end+1:]
+		if s != "" && s[0] != ':' {
+			return false
+		}
+	}
+	for i := range len(s) {
+		c := s[i]
+		if c == '@' || c == '/' || c == '?' || c == '#' || !isPathChar(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package response
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/headers"
+)
+
+// HeaderOrder selects the order WriteHeaders emits fields in.
+type HeaderOrder int
+
+const (
+	// OrderInsertion writes fields in the order they were added.
+	OrderInsertion HeaderOrder = iota
+	// OrderWellKnown writes the framing and common representation fields
+	// first in a fixed order, then the rest in the order they were added.
+	OrderWellKnown
+)
+
+// HeaderFormat controls how header and trailer fields are laid out on the
+// wire. The zero value writes fields in insertion order with canonical
+// casing.
+type HeaderFormat struct {
+	Order HeaderOrder
+	// PreserveCase writes field names exactly as they were added instead of
+	// canonicalising them to e.g. "Content-Type".
+	PreserveCase bool
+}
+
+// wellKnownOrder is the field order used by OrderWellKnown.
+var wellKnownOrder = []string{
+	"date",
+	"server",
+	"connection",
+	"content-type",
+	"content-length",
+	"transfer-encoding",
+	"trailer",
+	"content-encoding",
+	"cache-control",
+	"etag",
+	"last-modified",
+	"location",
+}
+
+func wellKnownRank(name string) int {
+	i := slices.Index(wellKnownOrder, strings.ToLower(name))
+	if i == -1 {
+		return len(wellKnownOrder)
+	}
+	return i
+}
+
+// fieldLines lays out h according to the format, one line per value.
+func (f HeaderFormat) fieldLines(h *headers.Headers) [][2]string {
+	lines := [][2]string{}
+	for name, value := range h.All() {
+		if !f.PreserveCase {
+			name = headers.CanonicalKey(name)
+		}
+		lines = append(lines, [2]string{name, value})
+	}
+	if f.Order == OrderWellKnown {
+		slices.SortStableFunc(lines, func(a, b [2]string) int {
+			return wellKnownRank(a[0]) - wellKnownRank(b[0])
+		})
+	}
+	return lines
+}
@@ -4,18 +4,197 @@ import "fmt"
 
 type StatusCode int
 
+// Status codes from the IANA HTTP Status Code Registry.
 const (
-	StatusOK                  StatusCode = 200
-	StatusBadRequest          StatusCode = 400
-	StatusInternalServerError StatusCode = 500
+	StatusContinue           StatusCode = 100
+	StatusSwitchingProtocols StatusCode = 101
+	StatusProcessing         StatusCode = 102
+	StatusEarlyHints         StatusCode = 103
+
+	StatusOK                   StatusCode = 200
+	StatusCreated              StatusCode = 201
+	StatusAccepted             StatusCode = 202
+	StatusNonAuthoritativeInfo StatusCode = 203
+	StatusNoContent            StatusCode = 204
+	StatusResetContent         StatusCode = 205
+	StatusPartialContent       StatusCode = 206
+	StatusMultiStatus          StatusCode = 207
+	StatusAlreadyReported      StatusCode = 208
+	StatusIMUsed               StatusCode = 226
+
+	StatusMultipleChoices   StatusCode = 300
+	StatusMovedPermanently  StatusCode = 301
+	StatusFound             StatusCode = 302
+	StatusSeeOther          StatusCode = 303
+	StatusNotModified       StatusCode = 304
+	StatusUseProxy          StatusCode = 305
+	StatusTemporaryRedirect StatusCode = 307
+	StatusPermanentRedirect StatusCode = 308
+
+	StatusBadRequest                 StatusCode = 400
+	StatusUnauthorized               StatusCode = 401
+	StatusPaymentRequired            StatusCode = 402
+	StatusForbidden                  StatusCode = 403
+	StatusNotFound                   StatusCode = 404
+	StatusMethodNotAllowed           StatusCode = 405
+	StatusNotAcceptable              StatusCode = 406
+	StatusProxyAuthRequired          StatusCode = 407
+	StatusRequestTimeout             StatusCode = 408
+	StatusConflict                   StatusCode = 409
+	StatusGone                       StatusCode = 410
+	StatusLengthRequired             StatusCode = 411
+	StatusPreconditionFailed         StatusCode = 412
+	StatusContentTooLarge            StatusCode = 413
+	StatusURITooLong                 StatusCode = 414
+	StatusUnsupportedMediaType       StatusCode = 415
+	StatusRangeNotSatisfiable        StatusCode = 416
+	StatusExpectationFailed          StatusCode = 417
+	StatusMisdirectedRequest         StatusCode = 421
+	StatusUnprocessableContent       StatusCode = 422
+	StatusLocked                     StatusCode = 423
+	StatusFailedDependency           StatusCode = 424
+	StatusTooEarly                   StatusCode = 425
+	StatusUpgradeRequired            StatusCode = 426
+	StatusPreconditionRequired       StatusCode = 428
+	StatusTooManyRequests            StatusCode = 429
+	StatusHeaderFieldsTooLarge       StatusCode = 431
+	StatusUnavailableForLegalReasons StatusCode = 451
+
+	StatusInternalServerError           StatusCode = 500
+	StatusNotImplemented                StatusCode = 501
+	StatusBadGateway                    StatusCode = 502
+	StatusServiceUnavailable            StatusCode = 503
+	StatusGatewayTimeout                StatusCode = 504
+	StatusHTTPVersionNotSupported       StatusCode = 505
+	StatusVariantAlsoNegotiates         StatusCode = 506
+	StatusInsufficientStorage           StatusCode = 507
+	StatusLoopDetected                  StatusCode = 508
+	StatusNotExtended                   StatusCode = 510
+	StatusNetworkAuthenticationRequired StatusCode = 511
 )
 
 var StatusMessage = map[StatusCode]string{
-	StatusOK:                  "OK",
-	StatusBadRequest:          "Bad Request",
-	StatusInternalServerError: "Internal Server Error",
+	StatusContinue:           "Continue",
+	StatusSwitchingProtocols: "Switching Protocols",
+	StatusProcessing:         "Processing",
+	StatusEarlyHints:         "Early Hints",
+
+	StatusOK:                   "OK",
+	StatusCreated:              "Created",
+	StatusAccepted:             "Accepted",
+	StatusNonAuthoritativeInfo: "Non-Authoritative Information",
+	StatusNoContent:            "No Content",
+	StatusResetContent:         "Reset Content",
+	StatusPartialContent:       "Partial Content",
+	StatusMultiStatus:          "Multi-Status",
+	StatusAlreadyReported:      "Already Reported",
+	StatusIMUsed:               "IM Used",
+
+	StatusMultipleChoices:   "Multiple Choices",
+	StatusMovedPermanently:  "Moved Permanently",
+	StatusFound:             "Found",
+	StatusSeeOther:          "See Other",
+	StatusNotModified:       "Not Modified",
+	StatusUseProxy:          "Use Proxy",
+	StatusTemporaryRedirect: "Temporary Redirect",
+	StatusPermanentRedirect: "Permanent Redirect",
+
+	StatusBadRequest:                 "Bad Request",
+	StatusUnauthorized:               "Unauthorized",
+	StatusPaymentRequired:            "Payment Required",
+	StatusForbidden:                  "Forbidden",
+	StatusNotFound:                   "Not Found",
+	StatusMethodNotAllowed:           "Method Not Allowed",
+	StatusNotAcceptable:              "Not Acceptable",
+	StatusProxyAuthRequired:          "Proxy Authentication Required",
+	StatusRequestTimeout:             "Request Timeout",
+	StatusConflict:                   "Conflict",
+	StatusGone:                       "Gone",
+	StatusLengthRequired:             "Length Required",
+	StatusPreconditionFailed:         "Precondition Failed",
+	StatusContentTooLarge:            "Content Too Large",
+	StatusURITooLong:                 "URI Too Long",
+	StatusUnsupportedMediaType:       "Unsupported Media Type",
+	StatusRangeNotSatisfiable:        "Range Not Satisfiable",
+	StatusExpectationFailed:          "Expectation Failed",
+	StatusMisdirectedRequest:         "Misdirected Request",
+	StatusUnprocessableContent:       "Unprocessable Content",
+	StatusLocked:                     "Locked",
+	StatusFailedDependency:           "Failed Dependency",
+	StatusTooEarly:                   "Too Early",
+	StatusUpgradeRequired:            "Upgrade Required",
+	StatusPreconditionRequired:       "Precondition Required",
+	StatusTooManyRequests:            "Too Many Requests",
+	StatusHeaderFieldsTooLarge:       "Request Header Fields Too Large",
+	StatusUnavailableForLegalReasons: "Unavailable For Legal Reasons",
+
+	StatusInternalServerError:           "Internal Server Error",
+	StatusNotImplemented:                "Not Implemented",
+	StatusBadGateway:                    "Bad Gateway",
+	StatusServiceUnavailable:            "Service Unavailable",
+	StatusGatewayTimeout:                "Gateway Timeout",
+	StatusHTTPVersionNotSupported:       "HTTP Version Not Supported",
+	StatusVariantAlsoNegotiates:         "Variant Also Negotiates",
+	StatusInsufficientStorage:           "Insufficient Storage",
+	StatusLoopDetected:                  "Loop Detected",
+	StatusNotExtended:                   "Not Extended",
+	StatusNetworkAuthenticationRequired: "Network Authentication Required",
+}
+
+// StatusText returns the registered reason phrase for code, or "" if the
+// code is unregistered.
+func StatusText(code StatusCode) string {
+	return StatusMessage[code]
+}
+
+// IsInformational reports whether code is a 1xx interim response.
+func (code StatusCode) IsInformational() bool {
+	return code >= 100 && code < 200
+}
+
+// IsSuccess reports whether code is a 2xx response.
+func (code StatusCode) IsSuccess() bool {
+	return code >= 200 && code < 300
+}
+
+// IsRedirect reports whether code is a 3xx response.
+func (code StatusCode) IsRedirect() bool {
+	return code >= 300 && code < 400
+}
+
+// IsClientError reports whether code is a 4xx response.
+func (code StatusCode) IsClientError() bool {
+	return code >= 400 && code < 500
+}
+
+// IsServerError reports whether code is a 5xx response.
+func (code StatusCode) IsServerError() bool {
+	return code >= 500 && code < 600
+}
+
+// IsValid reports whether code is a three-digit status code.
+func (code StatusCode) IsValid() bool {
+	return code >= 100 && code <= 999
+}
+
+// BodyAllowed reports whether a response with this status may carry a body.
+// 1xx, 204 and 304 responses never do, and end after their headers.
+func (code StatusCode) BodyAllowed() bool {
+	return !code.IsInformational() && code != StatusNoContent && code != StatusNotModified
+}
+
+func getStatusLine(version string, statusCode StatusCode, reason string) []byte {
+	return []byte(fmt.Sprintf("HTTP/%s %d %s\r\n", version, statusCode, reason))
 }
 
-func getStatusLine(statusCode StatusCode) []byte {
-	return []byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, StatusMessage[statusCode]))
+// validReason reports whether reason is a valid reason-phrase: tabs, spaces,
+// visible ASCII and obs-text, but no control characters.
+func validReason(reason string) bool {
+	for i := 0; i < len(reason); i++ {
+		c := reason[i]
+		if c != '\t' && (c < ' ' || c == 0x7f) {
+			return false
+		}
+	}
+	return true
 }
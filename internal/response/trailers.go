@@ -0,0 +1,90 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/headers"
+)
+
+var (
+	// ErrUndeclaredTrailer means a trailer field was not announced in the
+	// Trailer header.
+	ErrUndeclaredTrailer = errors.New("trailer field not declared in Trailer header")
+	// ErrProhibitedTrailer means a field that cannot be sent as a trailer
+	// was declared or written as one.
+	ErrProhibitedTrailer = errors.New("field not allowed in trailers")
+)
+
+// prohibitedTrailers are fields a recipient needs before the body, so they
+// must not be sent as trailers (RFC 9110 section 6.5.1): framing, routing,
+// request modifiers, authentication, response control data and the fields
+// describing how to process the content.
+var prohibitedTrailers = map[string]bool{
+	"transfer-encoding":   true,
+	"content-length":      true,
+	"host":                true,
+	"cache-control":       true,
+	"expect":              true,
+	"max-forwards":        true,
+	"pragma":              true,
+	"range":               true,
+	"te":                  true,
+	"if-match":            true,
+	"if-none-match":       true,
+	"if-modified-since":   true,
+	"if-unmodified-since": true,
+	"if-range":            true,
+	"authorization":       true,
+	"proxy-authorization": true,
+	"www-authenticate":    true,
+	"proxy-authenticate":  true,
+	"set-cookie":          true,
+	"age":                 true,
+	"date":                true,
+	"expires":             true,
+	"location":            true,
+	"retry-after":         true,
+	"vary":                true,
+	"warning":             true,
+	"content-encoding":    true,
+	"content-type":        true,
+	"content-range":       true,
+	"trailer":             true,
+	"connection":          true,
+}
+
+// declaredTrailers collects the field names listed in the Trailer header,
+// lower-cased.
+func declaredTrailers(h *headers.Headers) (map[string]bool, error) {
+	declared := map[string]bool{}
+	for _, v := range h.Values("Trailer") {
+		for name := range strings.SplitSeq(v, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if prohibitedTrailers[name] {
+				return nil, fmt.Errorf("%w: %s", ErrProhibitedTrailer, name)
+			}
+			declared[name] = true
+		}
+	}
+	return declared, nil
+}
+
+// checkTrailers verifies that every trailer field was declared and is
+// allowed as a trailer.
+func checkTrailers(trailers *headers.Headers, declared map[string]bool) error {
+	for name := range trailers.All() {
+		lower := strings.ToLower(name)
+		if prohibitedTrailers[lower] {
+			return fmt.Errorf("%w: %s", ErrProhibitedTrailer, name)
+		}
+		if !declared[lower] {
+			return fmt.Errorf("%w: %s", ErrUndeclaredTrailer, name)
+		}
+	}
+	return nil
+}
@@ -1,12 +1,29 @@
 package response
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 
 	"github.com/jacobdanielrose/httpfromtcp/internal/headers"
 )
 
+const crlf = "\r\n"
+
+// DefaultBufferSize is how much body a response without Content-Length or
+// Transfer-Encoding may buffer before it switches to chunked encoding.
+const DefaultBufferSize = 4 << 10
+
+// ErrBodyNotAllowed is returned when a handler writes body bytes for a status
+// that cannot have a body: 1xx, 204 No Content or 304 Not Modified.
+var ErrBodyNotAllowed = errors.New("response status does not allow a body")
+
+// ErrNotChunked is returned by the chunked body methods when the response is
+// framed by Content-Length, where chunk framing would corrupt the message.
+var ErrNotChunked = errors.New("response is not chunked")
+
 type writerState int
 
 const (
@@ -14,70 +31,521 @@ const (
 	writingHeaders
 	writingBody
 	writingTrailers
+	writingDone
 )
 
 type Writer struct {
-	writer io.Writer
-	state  writerState
+	writer  io.Writer
+	state   writerState
+	status  StatusCode
+	format  HeaderFormat
+	version string
+	method  string
+	// header and pendingStatus are what SetStatus and Header collect for
+	// the implicit commit on the first body write
+	header        *headers.Headers
+	pendingStatus StatusCode
+	// statusLine is held back until the headers are written, so a response
+	// is only on the wire, and sent set, once it can no longer change
+	statusLine []byte
+	sent       bool
+
+	closeConn bool
+	// closeCheck is asked again when the headers are written, since the
+	// connection may have been doomed while the handler ran
+	closeCheck    func() bool
+	contentLength int
+	// bodyWritten counts body bytes sent, excluding chunk framing
+	bodyWritten int
+	chunked     bool
+	chunkedDone bool
+	// deferred holds headers that gave no framing, written once the body
+	// length is known or the buffered body outgrows bufferSize
+	deferred   *headers.Headers
+	buf        []byte
+	bufferSize int
+	// trailers are the lower-cased field names declared in the Trailer
+	// header, the only ones WriteTrailers accepts
+	trailers map[string]bool
+	// noBody is set when the response ends with its headers, because the
+	// request was HEAD or the status allows no body
+	noBody bool
+	// unchunked is set when the handler asked for chunked encoding but the
+	// client speaks HTTP/1.0: chunks are written as plain body bytes and the
+	// connection closing ends the body
+	unchunked bool
 }
 
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
-		state:  writingStatus,
-		writer: w,
+		state:         writingStatus,
+		writer:        w,
+		version:       "1.1",
+		header:        headers.NewHeaders(),
+		contentLength: -1,
+		bufferSize:    DefaultBufferSize,
+	}
+}
+
+// SetBufferSize sets how much body a response of unknown length buffers
+// before switching to chunked encoding, in place of DefaultBufferSize.
+func (w *Writer) SetBufferSize(n int) {
+	w.bufferSize = n
+}
+
+// SetVersion sets the HTTP version of the request being answered, "1.0" or
+// "1.1". The status line echoes it, and an HTTP/1.0 client never receives
+// chunked encoding and only keeps the connection open when told to with
+// "Connection: keep-alive".
+func (w *Writer) SetVersion(version string) {
+	w.version = version
+}
+
+// SetMethod sets the method of the request being answered. A response to
+// HEAD carries the headers a GET would get, but any body written is
+// discarded.
+func (w *Writer) SetMethod(method string) {
+	w.method = method
+}
+
+// SetClose tells the Writer that the connection will be closed after this
+// response, so it announces "Connection: close" when the headers are written.
+func (w *Writer) SetClose(closeConn bool) {
+	w.closeConn = closeConn
+}
+
+// SetCloseCheck registers fn to be asked, just before the headers are
+// written, whether the connection will be closed after all, for reasons such
+// as a server shutdown that begin while the handler runs.
+func (w *Writer) SetCloseCheck(fn func() bool) {
+	w.closeCheck = fn
+}
+
+// Written reports whether any of the response has been sent, after which it
+// can no longer be replaced by a different one. The status line is held back
+// with the headers, so a response whose headers await the buffered body is
+// not yet written and can still be thrown away with Reset.
+func (w *Writer) Written() bool {
+	return w.sent
+}
+
+// Reset throws away a response that has not been written yet, with its
+// status, headers and buffered body, so that another one, typically an
+// error, can take its place. It fails once Written reports true.
+func (w *Writer) Reset() error {
+	if w.sent {
+		return errors.New("cannot reset a response that has been written")
+	}
+	*w = Writer{
+		state:         writingStatus,
+		writer:        w.writer,
+		format:        w.format,
+		version:       w.version,
+		method:        w.method,
+		header:        headers.NewHeaders(),
+		closeConn:     w.closeConn,
+		closeCheck:    w.closeCheck,
+		contentLength: -1,
+		bufferSize:    w.bufferSize,
+	}
+	return nil
+}
+
+// Header returns the header fields sent with the response. They can be
+// changed freely until the headers are written, either implicitly by the
+// first body write or by WriteHeaders, which adds them to its own fields.
+func (w *Writer) Header() *headers.Headers {
+	return w.header
+}
+
+// SetStatus sets the status sent when the response is committed by the
+// first body write, or by Finish if nothing is written. It defaults to 200
+// and has no effect once the status line is written.
+func (w *Writer) SetStatus(statusCode StatusCode) {
+	w.pendingStatus = statusCode
+}
+
+// Status returns the status of the response: the one given to
+// WriteStatusLine or committed by the first body write, otherwise the one set
+// with SetStatus, or 0.
+func (w *Writer) Status() StatusCode {
+	if w.state != writingStatus {
+		return w.status
+	}
+	return w.pendingStatus
+}
+
+// BytesWritten returns how many body bytes the response has accepted,
+// including any still buffered and excluding chunk framing.
+func (w *Writer) BytesWritten() int {
+	return w.bodyWritten + len(w.buf)
+}
+
+// commit writes whatever of the status line and headers the handler has not
+// written itself, from SetStatus and Header.
+func (w *Writer) commit() error {
+	if w.state == writingStatus {
+		status := w.pendingStatus
+		if status == 0 {
+			status = StatusOK
+		}
+		if err := w.WriteStatusLine(status); err != nil {
+			return err
+		}
+	}
+	if w.state == writingHeaders {
+		return w.WriteHeaders(headers.NewHeaders())
 	}
+	return nil
+}
+
+// SetHeaderFormat sets how header and trailer fields are laid out.
+func (w *Writer) SetHeaderFormat(format HeaderFormat) {
+	w.format = format
+}
+
+// KeepAlive reports whether the connection can carry another request after
+// this response: the response must be complete and properly delimited, and
+// neither side may have asked for the connection to be closed.
+func (w *Writer) KeepAlive() bool {
+	if w.closeConn || w.state == writingStatus || w.state == writingHeaders {
+		return false
+	}
+	if w.noBody {
+		return true
+	}
+	if w.chunked {
+		return w.chunkedDone
+	}
+	return w.bodyWritten == w.contentLength
 }
 
 func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	return w.WriteStatusLineReason(statusCode, StatusText(statusCode))
+}
+
+// WriteStatusLineReason writes the status line with a custom reason phrase
+// in place of the registered one.
+func (w *Writer) WriteStatusLineReason(statusCode StatusCode, reason string) error {
 	if w.state != writingStatus {
 		return fmt.Errorf("cannot write status line in state %d", w.state)
 	}
-	defer func() { w.state = writingHeaders }()
-	_, err := w.writer.Write(getStatusLine(statusCode))
-	return err
+	if !statusCode.IsValid() {
+		return fmt.Errorf("invalid status code: %d", statusCode)
+	}
+	if statusCode.IsInformational() && statusCode != StatusSwitchingProtocols {
+		return fmt.Errorf("interim status %d must be sent with WriteInformational", statusCode)
+	}
+	if !validReason(reason) {
+		return fmt.Errorf("invalid reason phrase: %q", reason)
+	}
+	w.status = statusCode
+	w.statusLine = getStatusLine(w.version, statusCode, reason)
+	w.state = writingHeaders
+	return nil
+}
+
+// WriteInformational sends an interim 1xx response, such as 103 Early Hints
+// with Link headers, ahead of the final one. Any number may be sent, but only
+// until the final response is written; h may be nil. 101 Switching Protocols
+// ends HTTP on the connection, so it is a final status for WriteStatusLine.
+// An HTTP/1.0 client cannot parse interim responses, so nothing is sent to
+// one.
+func (w *Writer) WriteInformational(statusCode StatusCode, h *headers.Headers) error {
+	if w.sent {
+		return errors.New("cannot write interim response after the final one")
+	}
+	if !statusCode.IsInformational() || statusCode == StatusSwitchingProtocols {
+		return fmt.Errorf("not an interim status code: %d", statusCode)
+	}
+	if w.version == "1.0" {
+		return nil
+	}
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+	if _, err := w.writer.Write(getStatusLine(w.version, statusCode, StatusText(statusCode))); err != nil {
+		return err
+	}
+	return w.writeFields(h)
 }
 
-func (w *Writer) WriteHeaders(headers headers.Headers) error {
+// WriteHeaders writes the header section. If it has neither Content-Length
+// nor Transfer-Encoding, it is held back while the body is buffered: a body
+// that fits the buffer is sent with its Content-Length, a larger one, or one
+// that is flushed early, with chunked encoding.
+func (w *Writer) WriteHeaders(headers *headers.Headers) error {
 	if w.state != writingHeaders {
 		return fmt.Errorf("cannot write headers in state %d", w.state)
 	}
-	defer func() { w.state = writingBody }()
-	for key, val := range headers {
-		_, err := w.writer.Write(fmt.Appendf([]byte{}, "%s: %s\r\n", key, val))
-		if err != nil {
-			return err
+	w.mergeHeader(headers)
+	chunked := headers.HasToken("Transfer-Encoding", "chunked")
+	contentLength := -1
+	if v, ok := headers.Get("Content-Length"); ok && !chunked {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			contentLength = n
 		}
 	}
-	_, err := w.writer.Write([]byte("\r\n"))
-	return err
+	if contentLength >= 0 {
+		// trailers can only follow a chunked body
+		headers.Del("Trailer")
+	}
+	declared, err := declaredTrailers(headers)
+	if err != nil {
+		// nothing has been sent, so the headers can still be fixed; until
+		// then an implicit commit fails on the same fields
+		w.header = headers
+		return err
+	}
+	w.state = writingBody
+	w.chunked, w.contentLength, w.trailers = chunked, contentLength, declared
+	// HEAD is buffered and measured like GET so it gets the same framing
+	// headers; the body is dropped when they are written
+	bodyExpected := w.status.BodyAllowed()
+	if !w.chunked && w.contentLength < 0 && bodyExpected && len(declared) > 0 {
+		// trailers can only follow a chunked body
+		headers.Set("Transfer-Encoding", "chunked")
+		w.chunked = true
+	}
+	if !w.chunked && w.contentLength < 0 && bodyExpected {
+		w.deferred = headers
+		return nil
+	}
+	return w.commitHeaders(headers)
 }
 
-func (w *Writer) WriteTrailers(trailers headers.Headers) error {
+// mergeHeader adds the fields set through Header to h, unless h has its own
+// values for them.
+func (w *Writer) mergeHeader(h *headers.Headers) {
+	if h == w.header {
+		return
+	}
+	present := map[string]bool{}
+	for name := range h.All() {
+		present[strings.ToLower(name)] = true
+	}
+	for name, value := range w.header.All() {
+		if !present[strings.ToLower(name)] {
+			h.Add(name, value)
+		}
+	}
+}
+
+// commitHeaders settles the framing of the response and writes its headers.
+func (w *Writer) commitHeaders(headers *headers.Headers) error {
+	if w.chunked && w.version == "1.0" {
+		w.chunked = false
+		w.unchunked = true
+		headers.Del("Transfer-Encoding")
+		headers.Del("Trailer")
+	}
+	if w.status.IsInformational() || w.status == StatusNoContent {
+		// RFC 9112 section 6.1 and RFC 9110 section 8.6 forbid both here
+		headers.Del("Transfer-Encoding")
+		headers.Del("Content-Length")
+	}
+	if !w.status.BodyAllowed() || w.method == "HEAD" {
+		// the response ends with its headers whatever they claim, which for
+		// HEAD and 304 describe the representation a GET would return
+		w.noBody = true
+		w.chunked = false
+		w.unchunked = false
+		w.contentLength = 0
+	}
+	// without a length or chunked framing the client can only find the end
+	// of the body by the connection closing
+	if !w.chunked && w.contentLength < 0 {
+		w.closeConn = true
+	}
+	if headers.HasToken("Connection", "close") {
+		w.closeConn = true
+	}
+	if w.closeCheck != nil && w.closeCheck() {
+		w.closeConn = true
+	}
+	if w.closeConn {
+		headers.Set("Connection", "close")
+	} else if w.version == "1.0" {
+		headers.Set("Connection", "keep-alive")
+	}
+
+	w.sent = true
+	if _, err := w.writer.Write(w.statusLine); err != nil {
+		return err
+	}
+	return w.writeFields(headers)
+}
+
+// WriteTrailers ends a chunked response with a trailer section after
+// WriteChunkedBodyDone, so it cannot be used on a Content-Length response,
+// whose Trailer header is dropped. Every field must have been declared in
+// the Trailer header and be allowed as a trailer; on error nothing is
+// written, and Finish still ends the response with an empty trailer section.
+func (w *Writer) WriteTrailers(trailers *headers.Headers) error {
 	if w.state != writingTrailers {
 		return fmt.Errorf("cannot write trailers in state %d", w.state)
 	}
-	defer func() { w.state = writingBody }()
-	for key, val := range trailers {
-		_, err := w.writer.Write(fmt.Appendf([]byte{}, "%s: %s\r\n", key, val))
-		if err != nil {
+	if err := checkTrailers(trailers, w.trailers); err != nil {
+		return err
+	}
+	defer func() { w.state = writingDone }()
+	if w.unchunked || w.noBody {
+		// an HTTP/1.0 or bodiless response has nowhere to carry trailers
+		w.chunkedDone = true
+		return nil
+	}
+	if err := w.writeFields(trailers); err != nil {
+		return err
+	}
+	w.chunkedDone = true
+	return nil
+}
+
+// writeFields writes a header or trailer section, including the empty line
+// that ends it.
+func (w *Writer) writeFields(h *headers.Headers) error {
+	buf := []byte{}
+	for _, line := range w.format.fieldLines(h) {
+		buf = fmt.Appendf(buf, "%s: %s\r\n", line[0], line[1])
+	}
+	buf = append(buf, crlf...)
+	_, err := w.writer.Write(buf)
+	return err
+}
+
+// Write writes body bytes with whatever framing the response uses, so that a
+// Writer can be handed to anything taking an io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	if err := w.commit(); err != nil {
+		return 0, err
+	}
+	if w.state != writingBody {
+		return 0, fmt.Errorf("cannot write body in state %d", w.state)
+	}
+	if w.deferred != nil {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) > w.bufferSize {
+			if err := w.commitDeferred(false); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	if w.chunked || w.unchunked {
+		if _, err := w.WriteChunkedBody(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return w.WriteBody(p)
+}
+
+// Flush sends the status line, the held-back headers and the buffered body
+// now, committing a response of unknown length to chunked encoding.
+func (w *Writer) Flush() error {
+	if err := w.commit(); err != nil {
+		return err
+	}
+	if w.state != writingBody || w.deferred == nil {
+		return nil
+	}
+	return w.commitDeferred(false)
+}
+
+// Finish completes the response once the handler is done with it: a
+// buffered body is sent with its Content-Length, and a chunked body gets its
+// last chunk and an empty trailer section if the handler did not write them.
+// A handler that wrote nothing gets an empty response with the status from
+// SetStatus. The server calls it once the handler returns.
+func (w *Writer) Finish() error {
+	if err := w.commit(); err != nil {
+		return err
+	}
+	if w.state == writingBody && w.deferred != nil {
+		return w.commitDeferred(true)
+	}
+	if w.state == writingBody && (w.chunked || w.unchunked) {
+		if _, err := w.WriteChunkedBodyDone(); err != nil {
 			return err
 		}
 	}
-	_, err := w.writer.Write([]byte("\r\n"))
+	if w.state == writingTrailers {
+		return w.WriteTrailers(headers.NewHeaders())
+	}
+	return nil
+}
+
+// commitDeferred writes the held-back headers, framed by Content-Length if
+// the body is complete or with chunked encoding if more may follow, and then
+// the buffered body.
+func (w *Writer) commitDeferred(complete bool) error {
+	h, buf := w.deferred, w.buf
+	w.deferred, w.buf = nil, nil
+	if complete {
+		h.Set("Content-Length", strconv.Itoa(len(buf)))
+		w.contentLength = len(buf)
+	} else {
+		h.Set("Transfer-Encoding", "chunked")
+		w.chunked = true
+	}
+	if err := w.commitHeaders(h); err != nil {
+		return err
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.Write(buf)
 	return err
 }
 
+// WriteBody writes body bytes as they are, committing the status and headers
+// first if they have not been written. Content-Length framing is up to the
+// caller; Write also handles chunked encoding.
 func (w *Writer) WriteBody(p []byte) (int, error) {
+	if err := w.commit(); err != nil {
+		return 0, err
+	}
 	if w.state != writingBody {
 		return 0, fmt.Errorf("cannot write body in state %d", w.state)
 	}
-	return w.writer.Write(p)
+	if w.deferred != nil {
+		return w.Write(p)
+	}
+	if w.noBody {
+		return w.discardBody(p)
+	}
+	n, err := w.writer.Write(p)
+	w.bodyWritten += n
+	return n, err
 }
 
+// WriteChunkedBody writes p as one chunk. It fails with ErrNotChunked if the
+// response is framed by Content-Length.
 func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
+	if err := w.commit(); err != nil {
+		return 0, err
+	}
 	if w.state != writingBody {
 		return 0, fmt.Errorf("cannot write body in state %d", w.state)
 	}
+	if w.deferred != nil {
+		return w.Write(p)
+	}
+	if w.noBody {
+		return w.discardBody(p)
+	}
+	if !w.chunked && !w.unchunked {
+		return 0, ErrNotChunked
+	}
+	if w.unchunked {
+		n, err := w.writer.Write(p)
+		w.bodyWritten += n
+		return n, err
+	}
+	if len(p) == 0 {
+		// an empty chunk would end the body
+		return 0, nil
+	}
 	chunkSize := len(p)
 
 	nTotal := 0
@@ -88,6 +556,7 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	nTotal += n
 
 	n, err = w.writer.Write(p)
+	w.bodyWritten += n
 	if err != nil {
 		return nTotal, err
 	}
@@ -101,10 +570,28 @@ func (w *Writer) WriteChunkedBody(p []byte) (int, error) {
 	return nTotal, nil
 }
 
+// WriteChunkedBodyDone writes the last chunk, after which WriteTrailers may
+// end the message. It fails with ErrNotChunked if the response is framed by
+// Content-Length.
 func (w *Writer) WriteChunkedBodyDone() (int, error) {
+	if err := w.commit(); err != nil {
+		return 0, err
+	}
 	if w.state != writingBody {
 		return 0, fmt.Errorf("cannot write body in state %d", w.state)
 	}
+	if w.deferred != nil {
+		if err := w.commitDeferred(false); err != nil {
+			return 0, err
+		}
+	}
+	if w.unchunked || w.noBody {
+		w.state = writingTrailers
+		return 0, nil
+	}
+	if !w.chunked {
+		return 0, ErrNotChunked
+	}
 	n, err := w.writer.Write([]byte("0\r\n"))
 	if err != nil {
 		return n, err
@@ -112,3 +599,13 @@ func (w *Writer) WriteChunkedBodyDone() (int, error) {
 	w.state = writingTrailers
 	return n, nil
 }
+
+// discardBody swallows body bytes for a response that has none: silently for
+// HEAD, so handlers can share code with GET, and with ErrBodyNotAllowed for a
+// status that never has a body.
+func (w *Writer) discardBody(p []byte) (int, error) {
+	if len(p) == 0 || w.method == "HEAD" && w.status.BodyAllowed() {
+		return len(p), nil
+	}
+	return 0, fmt.Errorf("%w: %d", ErrBodyNotAllowed, w.status)
+}
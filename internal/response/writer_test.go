@@ -0,0 +1,588 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusLine(t *testing.T) {
+	// Test: Registered reason phrase
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusTooManyRequests))
+	assert.Empty(t, buf.String())
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 429 Too Many Requests\r\n"))
+
+	// Test: Unregistered code keeps the separator with an empty reason
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusCode(599)))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 599 \r\n"))
+
+	// Test: Custom reason phrase
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLineReason(StatusOK, "Totally Fine"))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 Totally Fine\r\n"))
+
+	// Test: Reason phrase cannot inject lines
+	w = NewWriter(&bytes.Buffer{})
+	require.Error(t, w.WriteStatusLineReason(StatusOK, "OK\r\nX-Evil: 1"))
+
+	// Test: Status code must have three digits
+	w = NewWriter(&bytes.Buffer{})
+	require.Error(t, w.WriteStatusLine(StatusCode(42)))
+}
+
+func TestInformational(t *testing.T) {
+	// Test: Several interim responses before the final one
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	hints := headers.NewHeaders()
+	hints.Add("Link", "</style.css>; rel=preload; as=style")
+	hints.Add("Link", "</app.js>; rel=preload; as=script")
+	require.NoError(t, w.WriteInformational(StatusContinue, nil))
+	require.NoError(t, w.WriteInformational(StatusEarlyHints, hints))
+	assert.False(t, w.Written())
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n\r\n"+
+		"HTTP/1.1 103 Early Hints\r\n"+
+		"Link: </style.css>; rel=preload; as=style\r\n"+
+		"Link: </app.js>; rel=preload; as=script\r\n"+
+		"\r\n"+
+		"HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n", buf.String())
+
+	// Test: Only 1xx other than 101 is interim, and only before the final
+	// response is sent
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.Error(t, w.WriteInformational(StatusOK, nil))
+	require.Error(t, w.WriteInformational(StatusSwitchingProtocols, nil))
+	require.Error(t, w.WriteStatusLine(StatusEarlyHints))
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteInformational(StatusContinue, nil))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	require.Error(t, w.WriteInformational(StatusEarlyHints, nil))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 OK\r\n"))
+
+	// Test: Nothing is sent to HTTP/1.0 clients
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetVersion("1.0")
+	require.NoError(t, w.WriteInformational(StatusEarlyHints, hints))
+	assert.Empty(t, buf.String())
+}
+
+func TestStatusClasses(t *testing.T) {
+	assert.True(t, StatusEarlyHints.IsInformational())
+	assert.True(t, StatusNoContent.IsSuccess())
+	assert.True(t, StatusPermanentRedirect.IsRedirect())
+	assert.True(t, StatusTooEarly.IsClientError())
+	assert.True(t, StatusLoopDetected.IsServerError())
+	assert.False(t, StatusOK.IsRedirect())
+
+	assert.True(t, StatusOK.BodyAllowed())
+	assert.False(t, StatusContinue.BodyAllowed())
+	assert.False(t, StatusNoContent.BodyAllowed())
+	assert.False(t, StatusNotModified.BodyAllowed())
+}
+
+func TestKeepAliveFraming(t *testing.T) {
+	// Test: Complete Content-Length body
+	w := NewWriter(&bytes.Buffer{})
+	w.WriteStatusLine(StatusOK)
+	w.WriteHeaders(GetDefaultHeaders(5))
+	w.WriteBody([]byte("hello"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Body shorter than its Content-Length
+	w = NewWriter(&bytes.Buffer{})
+	w.WriteStatusLine(StatusOK)
+	w.WriteHeaders(GetDefaultHeaders(5))
+	w.WriteBody([]byte("hel"))
+	assert.False(t, w.KeepAlive())
+
+	// Test: 204 needs no framing headers
+	buf := &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.WriteStatusLine(StatusNoContent)
+	h := GetDefaultHeaders(0)
+	h.Del("Content-Length")
+	w.WriteHeaders(h)
+	assert.True(t, w.KeepAlive())
+	assert.NotContains(t, buf.String(), "Connection: close")
+}
+
+func TestHTTP10Response(t *testing.T) {
+	// Test: Status line echoes HTTP/1.0 and keep-alive is announced
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	w.WriteBody([]byte("ok"))
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n"+
+		"Content-Length: 2\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Connection: keep-alive\r\n"+
+		"\r\nok", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Chunked encoding is dropped and the connection closed instead
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetVersion("1.0")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "HTTP/1.0 200 OK\r\n"+
+		"Connection: close\r\n"+
+		"\r\nhello", buf.String())
+	assert.False(t, w.KeepAlive())
+}
+
+func TestBodylessResponses(t *testing.T) {
+	// Test: HEAD keeps the GET headers and discards the body
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetMethod("HEAD")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	n, err := w.WriteBody([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 5\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: HEAD of a chunked response writes no chunks
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetMethod("HEAD")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(headers.NewHeaders()))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: HEAD without framing is measured like GET
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetMethod("HEAD")
+	_, err = io.WriteString(w, "hello")
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: 204 drops framing headers and refuses a body
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusNoContent))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteBody([]byte("hello"))
+	require.ErrorIs(t, err, ErrBodyNotAllowed)
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: 304 keeps Content-Length but refuses a body
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusNotModified))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = w.WriteChunkedBody([]byte("hello"))
+	require.ErrorIs(t, err, ErrBodyNotAllowed)
+	assert.Contains(t, buf.String(), "Content-Length: 5\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.True(t, w.KeepAlive())
+}
+
+func TestAutoFraming(t *testing.T) {
+	start := func(buf *bytes.Buffer) *Writer {
+		w := NewWriter(buf)
+		w.SetBufferSize(8)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		h := headers.NewHeaders()
+		h.Set("Content-Type", "text/plain")
+		require.NoError(t, w.WriteHeaders(h))
+		return w
+	}
+
+	// Test: Small body gets a Content-Length
+	buf := &bytes.Buffer{}
+	w := start(buf)
+	_, err := io.WriteString(w, "hel")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "lo")
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+	assert.False(t, w.Written())
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 5\r\n"+
+		"\r\nhello", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Empty body
+	buf = &bytes.Buffer{}
+	w = start(buf)
+	require.NoError(t, w.Finish())
+	assert.Contains(t, buf.String(), "Content-Length: 0\r\n\r\n")
+	assert.True(t, w.KeepAlive())
+
+	// Test: Body outgrowing the buffer switches to chunked
+	buf = &bytes.Buffer{}
+	w = start(buf)
+	n, err := io.WriteString(w, "hello ")
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+	_, err = io.WriteString(w, "world")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "!")
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"b\r\nhello world\r\n"+
+		"1\r\n!\r\n"+
+		"0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Flush commits to chunked early
+	buf = &bytes.Buffer{}
+	w = start(buf)
+	_, err = io.WriteString(w, "hi")
+	require.NoError(t, err)
+	require.NoError(t, w.Flush())
+	assert.True(t, strings.HasSuffix(buf.String(), "Transfer-Encoding: chunked\r\n\r\n2\r\nhi\r\n"))
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\n\r\n"))
+
+	// Test: HTTP/1.0 gets a close-delimited body instead of chunks
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetVersion("1.0")
+	w.SetBufferSize(2)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(headers.NewHeaders()))
+	_, err = io.WriteString(w, "hello")
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.0 200 OK\r\nConnection: close\r\n\r\nhello", buf.String())
+	assert.False(t, w.KeepAlive())
+
+	// Test: Explicit framing is written straight through
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	_, err = io.WriteString(w, "hello")
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+}
+
+func TestTrailers(t *testing.T) {
+	start := func(buf *bytes.Buffer, trailer string) *Writer {
+		w := NewWriter(buf)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		h := headers.NewHeaders()
+		h.Set("Trailer", trailer)
+		require.NoError(t, w.WriteHeaders(h))
+		return w
+	}
+
+	// Test: Declared trailers imply chunked encoding
+	buf := &bytes.Buffer{}
+	w := start(buf, "X-Checksum")
+	_, err := io.WriteString(w, "hello")
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers := headers.NewHeaders()
+	trailers.Set("x-checksum", "abc")
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Trailer: X-Checksum\r\n"+
+		"Transfer-Encoding: chunked\r\n"+
+		"\r\n"+
+		"5\r\nhello\r\n"+
+		"0\r\n"+
+		"X-Checksum: abc\r\n"+
+		"\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Nothing may be written after the trailers
+	_, err = w.Write([]byte("more"))
+	require.Error(t, err)
+	require.Error(t, w.WriteTrailers(trailers))
+	require.NoError(t, w.Finish())
+
+	// Test: Undeclared and prohibited trailers are refused
+	buf = &bytes.Buffer{}
+	w = start(buf, "X-Checksum")
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	trailers = headers.NewHeaders()
+	trailers.Set("X-Other", "1")
+	require.ErrorIs(t, w.WriteTrailers(trailers), ErrUndeclaredTrailer)
+	trailers = headers.NewHeaders()
+	trailers.Set("Content-Length", "5")
+	require.ErrorIs(t, w.WriteTrailers(trailers), ErrProhibitedTrailer)
+
+	// Test: Finish still terminates the message
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n0\r\n\r\n"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Declaring a prohibited trailer fails and sends nothing
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := headers.NewHeaders()
+	h.Set("Trailer", "X-Checksum, Content-Type")
+	require.ErrorIs(t, w.WriteHeaders(h), ErrProhibitedTrailer)
+	_, err = io.WriteString(w, "hello")
+	require.Error(t, err)
+	assert.Empty(t, buf.String())
+	assert.False(t, w.Written())
+
+	// Test: Headers can be written again once fixed
+	h.Set("Trailer", "X-Checksum")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = io.WriteString(w, "hello")
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(buf.String(), "5\r\nhello\r\n0\r\n\r\n"))
+
+	// Test: Implicit commit with a prohibited trailer fails and sends nothing
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("Trailer", "Content-Type")
+	_, err = io.WriteString(w, "hello")
+	require.ErrorIs(t, err, ErrProhibitedTrailer)
+	require.ErrorIs(t, w.Finish(), ErrProhibitedTrailer)
+	assert.Empty(t, buf.String())
+
+	// Test: Chunk framing is refused on a Content-Length response
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h = GetDefaultHeaders(2)
+	h.Set("Trailer", "X-Sum")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.NotContains(t, buf.String(), "Trailer")
+	_, err = w.WriteChunkedBody([]byte("ab"))
+	require.ErrorIs(t, err, ErrNotChunked)
+	_, err = w.WriteChunkedBodyDone()
+	require.ErrorIs(t, err, ErrNotChunked)
+	require.Error(t, w.WriteTrailers(headers.NewHeaders()))
+	_, err = w.WriteBody([]byte("ab"))
+	require.NoError(t, err)
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nab"))
+	assert.True(t, w.KeepAlive())
+
+	// Test: Chunked body left open by the handler is finished
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h = headers.NewHeaders()
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteHeaders(h))
+	_, err = w.WriteChunkedBody([]byte("hi"))
+	require.NoError(t, err)
+	assert.False(t, w.KeepAlive())
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasSuffix(buf.String(), "2\r\nhi\r\n0\r\n\r\n"))
+	assert.True(t, w.KeepAlive())
+}
+
+func TestImplicitCommit(t *testing.T) {
+	// Test: First write commits 200 and the Header fields
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("X-Draft", "1")
+	w.Header().Del("X-Draft")
+	assert.False(t, w.Written())
+	assert.Equal(t, StatusCode(0), w.Status())
+	_, err := io.WriteString(w, "hello")
+	require.NoError(t, err)
+	assert.False(t, w.Written())
+	assert.Equal(t, StatusOK, w.Status())
+	assert.Equal(t, 5, w.BytesWritten())
+	require.NoError(t, w.Finish())
+	assert.True(t, w.Written())
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 5\r\n"+
+		"\r\nhello", buf.String())
+	assert.Equal(t, 5, w.BytesWritten())
+
+	// Test: SetStatus is used by the commit and can change until then
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetStatus(StatusNotFound)
+	w.SetStatus(StatusCreated)
+	assert.Equal(t, StatusCreated, w.Status())
+	_, err = w.WriteBody([]byte("made"))
+	require.NoError(t, err)
+	w.SetStatus(StatusGone)
+	assert.Equal(t, StatusCreated, w.Status())
+	require.NoError(t, w.Finish())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 201 Created\r\n"))
+
+	// Test: Nothing written still produces a complete response
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.SetStatus(StatusAccepted)
+	require.NoError(t, w.Finish())
+	assert.Equal(t, "HTTP/1.1 202 Accepted\r\nContent-Length: 0\r\n\r\n", buf.String())
+	assert.True(t, w.KeepAlive())
+
+	// Test: Explicit headers are merged with Header fields
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	w.Header().Set("X-Request-Id", "abc")
+	w.Header().Set("Content-Type", "text/html")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(2)))
+	_, err = w.Write([]byte("ok"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 2\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"X-Request-Id: abc\r\n"+
+		"\r\nok", buf.String())
+
+	// Test: Status line written, headers left to the commit
+	buf = &bytes.Buffer{}
+	w = NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	w.Header().Set("Content-Length", "2")
+	_, err = w.Write([]byte("ok"))
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok", buf.String())
+
+	// Test: Chunk framing is not counted
+	w = NewWriter(&bytes.Buffer{})
+	w.Header().Set("Transfer-Encoding", "chunked")
+	_, err = w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, w.BytesWritten())
+}
+
+func TestWriteHeadersMultiValue(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	h := GetDefaultHeaders(0)
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	require.NoError(t, w.WriteHeaders(h))
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Length: 0\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Set-Cookie: a=1\r\n"+
+		"Set-Cookie: b=2\r\n"+
+		"\r\n", buf.String())
+}
+
+func TestHeaderFormat(t *testing.T) {
+	newHeaders := func() *headers.Headers {
+		h := headers.NewHeaders()
+		h.Set("x-request-id", "abc")
+		h.Set("content-length", "0")
+		h.Set("etag", `"v1"`)
+		h.Set("content-type", "text/plain")
+		return h
+	}
+	write := func(format HeaderFormat) string {
+		buf := &bytes.Buffer{}
+		w := NewWriter(buf)
+		w.SetHeaderFormat(format)
+		require.NoError(t, w.WriteStatusLine(StatusOK))
+		require.NoError(t, w.WriteHeaders(newHeaders()))
+		return buf.String()
+	}
+
+	// Test: Default is insertion order with canonical casing
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"X-Request-Id: abc\r\n"+
+		"Content-Length: 0\r\n"+
+		"ETag: \"v1\"\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"\r\n", write(HeaderFormat{}))
+
+	// Test: Well-known fields first, the rest in insertion order
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"Content-Type: text/plain\r\n"+
+		"Content-Length: 0\r\n"+
+		"ETag: \"v1\"\r\n"+
+		"X-Request-Id: abc\r\n"+
+		"\r\n", write(HeaderFormat{Order: OrderWellKnown}))
+
+	// Test: Preserved casing
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n"+
+		"x-request-id: abc\r\n"+
+		"content-length: 0\r\n"+
+		"etag: \"v1\"\r\n"+
+		"content-type: text/plain\r\n"+
+		"\r\n", write(HeaderFormat{PreserveCase: true}))
+}
+
+func TestReset(t *testing.T) {
+	// Test: Held response is replaced
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+	w.SetVersion("1.0")
+	w.Header().Set("X-Draft", "1")
+	require.NoError(t, w.WriteStatusLine(StatusOK))
+	_, err := io.WriteString(w, "partial")
+	require.NoError(t, err)
+	require.NoError(t, w.Reset())
+	assert.Empty(t, buf.String())
+	require.NoError(t, w.WriteStatusLine(StatusInternalServerError))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.0 500 Internal Server Error\r\n"))
+	assert.NotContains(t, buf.String(), "X-Draft")
+
+	// Test: Sent response cannot be reset
+	require.Error(t, w.Reset())
+}
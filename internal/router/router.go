@@ -0,0 +1,274 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/request"
+	"github.com/jacobdanielrose/httpfromtcp/internal/response"
+	"github.com/jacobdanielrose/httpfromtcp/internal/server"
+)
+
+// Router dispatches requests to handlers registered for a method and path
+// pattern. Patterns look like "GET /users/{id}" or "/static/*": the method is
+// optional, "{name}" captures a single path segment and a trailing "*"
+// captures the rest of the path. Paths are matched segment by segment, each
+// percent-decoded on its own, so "%2F" never acts as a separator. Captured
+// values are available through Request.PathValue, with the "*" match stored
+// under the name "*".
+type Router struct {
+	routes []*route
+}
+
+type segmentKind int
+
+const (
+	segmentLiteral segmentKind = iota
+	segmentParam
+	segmentWildcard
+)
+
+type segment struct {
+	kind  segmentKind
+	value string
+}
+
+type route struct {
+	method   string
+	segments []segment
+	handler  server.Handler
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for pattern. It panics if the pattern is malformed
+// or was already registered, since both are programming errors.
+func (rt *Router) Handle(pattern string, handler server.Handler) {
+	r, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	for _, existing := range rt.routes {
+		if existing.method == r.method && slices.Equal(existing.segments, r.segments) {
+			panic(fmt.Sprintf("router: pattern %q registered twice", pattern))
+		}
+	}
+	r.handler = handler
+	rt.routes = append(rt.routes, r)
+}
+
+// Serve is a server.Handler that dispatches to the best matching route,
+// answering 404 when no pattern matches the path and 405 with an Allow header
+// when patterns match the path but not the method. A HEAD request is served
+// by the GET route when there is no HEAD route, and OPTIONS is answered with
+// the methods the path allows unless a route handles it. A CONNECT request
+// names a host rather than a path, so it goes to the first route registered
+// for the CONNECT method whatever its path, and is answered 405 without one.
+func (rt *Router) Serve(w *response.Writer, req *request.Request) {
+	switch req.RequestLine.Target.Form {
+	case request.FormAsterisk:
+		options(w, rt.allMethods())
+		return
+	case request.FormAuthority:
+		// a path-less target must not fall through to the "/" routes, where
+		// a 2xx would tell the client its tunnel is open
+		for _, r := range rt.routes {
+			if r.method == "CONNECT" {
+				r.handler(w, req)
+				return
+			}
+		}
+		methodNotAllowed(w, rt.allMethods())
+		return
+	}
+	segments := decodeSegments(splitPath(req.RequestLine.Target.RawPath))
+	method := req.RequestLine.Method
+
+	var best *route
+	var bestValues map[string]string
+	allowed := []string{}
+	for _, r := range rt.routes {
+		values, ok := r.match(segments)
+		if !ok {
+			continue
+		}
+		if !r.allows(method) {
+			allowed = append(allowed, r.method)
+			if r.method == "GET" {
+				allowed = append(allowed, "HEAD")
+			}
+			continue
+		}
+		// an explicit HEAD route beats an equally specific GET route
+		if best == nil || r.moreSpecificThan(best) ||
+			!best.moreSpecificThan(r) && r.method == method && best.method != method {
+			best = r
+			bestValues = values
+		}
+	}
+
+	if best == nil {
+		if len(allowed) > 0 {
+			allowed = append(allowed, "OPTIONS")
+			slices.Sort(allowed)
+			allowed = slices.Compact(allowed)
+			if method == "OPTIONS" {
+				options(w, allowed)
+				return
+			}
+			methodNotAllowed(w, allowed)
+			return
+		}
+		notFound(w)
+		return
+	}
+	for name, value := range bestValues {
+		req.SetPathValue(name, value)
+	}
+	best.handler(w, req)
+}
+
+// allMethods lists every method some route accepts, for "OPTIONS *".
+func (rt *Router) allMethods() []string {
+	methods := []string{"OPTIONS"}
+	for _, r := range rt.routes {
+		if r.method != "" {
+			methods = append(methods, r.method)
+		}
+		if r.method == "GET" {
+			methods = append(methods, "HEAD")
+		}
+	}
+	slices.Sort(methods)
+	return slices.Compact(methods)
+}
+
+func parsePattern(pattern string) (*route, error) {
+	r := &route{}
+	path := pattern
+	if method, rest, ok := strings.Cut(pattern, " "); ok {
+		r.method = method
+		path = strings.TrimLeft(rest, " ")
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("router: pattern %q must start with /", pattern)
+	}
+
+	names := map[string]bool{}
+	parts := splitPath(path)
+	for i, part := range parts {
+		switch {
+		case part == "*":
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("router: wildcard must be the last segment in %q", pattern)
+			}
+			r.segments = append(r.segments, segment{kind: segmentWildcard, value: "*"})
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			name := part[1 : len(part)-1]
+			if name == "" || names[name] {
+				return nil, fmt.Errorf("router: bad or repeated parameter %q in %q", part, pattern)
+			}
+			names[name] = true
+			r.segments = append(r.segments, segment{kind: segmentParam, value: name})
+		default:
+			r.segments = append(r.segments, segment{kind: segmentLiteral, value: part})
+		}
+	}
+	return r, nil
+}
+
+func (r *route) allows(method string) bool {
+	return r.method == "" || r.method == method || r.method == "GET" && method == "HEAD"
+}
+
+func (r *route) match(path []string) (map[string]string, bool) {
+	values := map[string]string{}
+	for i, seg := range r.segments {
+		if seg.kind == segmentWildcard {
+			values["*"] = strings.Join(path[i:], "/")
+			return values, true
+		}
+		if i >= len(path) {
+			return nil, false
+		}
+		switch seg.kind {
+		case segmentLiteral:
+			if path[i] != seg.value {
+				return nil, false
+			}
+		case segmentParam:
+			if path[i] == "" {
+				return nil, false
+			}
+			values[seg.value] = path[i]
+		}
+	}
+	if len(path) != len(r.segments) {
+		return nil, false
+	}
+	return values, true
+}
+
+// moreSpecificThan orders two routes that both match a request: a literal
+// segment beats a parameter, which beats a wildcard, and a route with a
+// method beats one without.
+func (r *route) moreSpecificThan(other *route) bool {
+	for i := 0; i < len(r.segments) && i < len(other.segments); i++ {
+		if r.segments[i].kind != other.segments[i].kind {
+			return r.segments[i].kind < other.segments[i].kind
+		}
+	}
+	if len(r.segments) != len(other.segments) {
+		return len(r.segments) > len(other.segments)
+	}
+	return r.method != "" && other.method == ""
+}
+
+// splitPath splits "/a/b" into ["a", "b"]; the root path "/" is a single
+// empty segment so that it only matches "/" or a wildcard.
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+// decodeSegments percent-decodes each segment of a raw path on its own, so
+// that an encoded "/" stays inside its segment instead of splitting it.
+func decodeSegments(raw []string) []string {
+	segments := make([]string, len(raw))
+	for i, seg := range raw {
+		decoded, err := url.PathUnescape(seg)
+		if err != nil {
+			// the request parser has already rejected bad percent-encoding
+			decoded = seg
+		}
+		segments[i] = decoded
+	}
+	return segments
+}
+
+func notFound(w *response.Writer) {
+	w.WriteStatusLine(response.StatusNotFound)
+	body := []byte("404 page not found\n")
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func methodNotAllowed(w *response.Writer, allowed []string) {
+	w.WriteStatusLine(response.StatusMethodNotAllowed)
+	body := []byte("405 method not allowed\n")
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Allow", strings.Join(allowed, ", "))
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+func options(w *response.Writer, allowed []string) {
+	w.WriteStatusLine(response.StatusNoContent)
+	h := response.GetDefaultHeaders(0)
+	h.Del("Content-Type")
+	h.Set("Allow", strings.Join(allowed, ", "))
+	w.WriteHeaders(h)
+}
@@ -0,0 +1,148 @@
+package router
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/request"
+	"github.com/jacobdanielrose/httpfromtcp/internal/response"
+	"github.com/jacobdanielrose/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(rt *Router, method, target string) (string, *request.Request) {
+	buf := &bytes.Buffer{}
+	req, err := request.RequestFromReader(strings.NewReader(method + " " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	if err != nil {
+		panic(err)
+	}
+	rt.Serve(response.NewWriter(buf), req)
+	return buf.String(), req
+}
+
+func named(name string) server.Handler {
+	return func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		body := []byte(name)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	rt := New()
+	rt.Handle("GET /users/{id}", named("user"))
+	rt.Handle("GET /users/me", named("me"))
+	rt.Handle("POST /users/{id}", named("update"))
+	rt.Handle("/static/*", named("static"))
+	rt.Handle("GET /", named("root"))
+
+	// Test: Path parameter
+	out, req := serve(rt, "GET", "/users/42?verbose=1")
+	assert.Contains(t, out, "HTTP/1.1 200 OK")
+	assert.Contains(t, out, "user")
+	assert.Equal(t, "42", req.PathValue("id"))
+
+	// Test: Literal segment beats parameter
+	out, _ = serve(rt, "GET", "/users/me")
+	assert.Contains(t, out, "\r\n\r\nme")
+
+	// Test: Method selects between routes on the same path
+	out, req = serve(rt, "POST", "/users/7")
+	assert.Contains(t, out, "update")
+	assert.Equal(t, "7", req.PathValue("id"))
+
+	// Test: Wildcard captures the rest of the path for any method
+	out, req = serve(rt, "DELETE", "/static/css/site.css")
+	assert.Contains(t, out, "static")
+	assert.Equal(t, "css/site.css", req.PathValue("*"))
+
+	// Test: Encoded slash stays inside its segment
+	out, req = serve(rt, "GET", "/users/a%2Fb")
+	assert.Contains(t, out, "user")
+	assert.Equal(t, "a/b", req.PathValue("id"))
+	out, _ = serve(rt, "GET", "/users%2Fme")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found")
+
+	// Test: Root
+	out, _ = serve(rt, "GET", "/")
+	assert.Contains(t, out, "root")
+
+	// Test: Unknown path
+	out, _ = serve(rt, "GET", "/nope")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found")
+
+	// Test: Known path, wrong method
+	out, _ = serve(rt, "DELETE", "/users/42")
+	assert.Contains(t, out, "HTTP/1.1 405 Method Not Allowed")
+	assert.Contains(t, out, "Allow: GET, HEAD, OPTIONS, POST\r\n")
+
+	// Test: HEAD falls back to the GET route
+	out, req = serve(rt, "HEAD", "/users/42")
+	assert.Contains(t, out, "user")
+	assert.Equal(t, "42", req.PathValue("id"))
+
+	// Test: Explicit HEAD route wins over GET
+	rt.Handle("HEAD /users/{id}", named("head"))
+	out, _ = serve(rt, "HEAD", "/users/42")
+	assert.Contains(t, out, "head")
+}
+
+func TestRouterOptions(t *testing.T) {
+	rt := New()
+	rt.Handle("GET /users/{id}", named("user"))
+	rt.Handle("DELETE /users/{id}", named("delete"))
+	rt.Handle("PUT /files/*", named("upload"))
+	rt.Handle("/any", named("any"))
+
+	// Test: Allow lists the methods routed for the path
+	out, _ := serve(rt, "OPTIONS", "/users/42")
+	assert.Contains(t, out, "HTTP/1.1 204 No Content\r\n")
+	assert.Contains(t, out, "Allow: DELETE, GET, HEAD, OPTIONS\r\n")
+	assert.NotContains(t, out, "Content-Length")
+
+	// Test: Unknown path is still 404
+	out, _ = serve(rt, "OPTIONS", "/nope")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found")
+
+	// Test: A route for any method handles OPTIONS itself
+	out, _ = serve(rt, "OPTIONS", "/any")
+	assert.Contains(t, out, "\r\n\r\nany")
+
+	// Test: An explicit OPTIONS route wins
+	rt.Handle("OPTIONS /users/{id}", named("custom"))
+	out, _ = serve(rt, "OPTIONS", "/users/42")
+	assert.Contains(t, out, "\r\n\r\ncustom")
+
+	// Test: OPTIONS * lists every routed method
+	out, _ = serve(rt, "OPTIONS", "*")
+	assert.Contains(t, out, "HTTP/1.1 204 No Content\r\n")
+	assert.Contains(t, out, "Allow: DELETE, GET, HEAD, OPTIONS, PUT\r\n")
+}
+
+func TestRouterConnect(t *testing.T) {
+	rt := New()
+	rt.Handle("GET /", named("root"))
+	rt.Handle("/*", named("any"))
+
+	// Test: CONNECT does not match path routes
+	out, _ := serve(rt, "CONNECT", "example.com:443")
+	assert.Contains(t, out, "HTTP/1.1 405 Method Not Allowed\r\n")
+	assert.Contains(t, out, "Allow: GET, HEAD, OPTIONS\r\n")
+
+	// Test: A CONNECT route handles every authority
+	rt.Handle("CONNECT /", named("tunnel"))
+	out, _ = serve(rt, "CONNECT", "example.com:443")
+	assert.Contains(t, out, "\r\n\r\ntunnel")
+}
+
+func TestRouterBadPatterns(t *testing.T) {
+	rt := New()
+	require.Panics(t, func() { rt.Handle("users", named("x")) })
+	require.Panics(t, func() { rt.Handle("/a/*/b", named("x")) })
+	require.Panics(t, func() { rt.Handle("/a/{id}/{id}", named("x")) })
+	rt.Handle("GET /a", named("x"))
+	require.Panics(t, func() { rt.Handle("GET /a", named("y")) })
+}
@@ -0,0 +1,14 @@
+package server
+
+// Middleware wraps a Handler with behaviour that runs around it, such as
+// logging or authentication.
+type Middleware func(Handler) Handler
+
+// Chain wraps handler in the given middlewares. The first middleware is the
+// outermost, so it sees the request first and the response last.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"time"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/headers"
+	"github.com/jacobdanielrose/httpfromtcp/internal/request"
+	"github.com/jacobdanielrose/httpfromtcp/internal/response"
+)
+
+type config struct {
+	limits             request.Limits
+	idleTimeout        time.Duration
+	readHeaderTimeout  time.Duration
+	readBodyTimeout    time.Duration
+	writeTimeout       time.Duration
+	maxRequestsPerConn int
+	bufferBody         bool
+	headerFormat       response.HeaderFormat
+	headerOptions      headers.ParseOptions
+	trace              bool
+}
+
+// Option configures a Server.
+type Option func(*config)
+
+// WithIdleTimeout sets how long a connection may sit waiting for the first
+// byte of its next request before it is closed. Zero means no limit.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.idleTimeout = d
+	}
+}
+
+// WithReadHeaderTimeout bounds the time from the first byte of a request to
+// the end of its headers. Zero means no limit.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.readHeaderTimeout = d
+	}
+}
+
+// WithReadBodyTimeout bounds the time the handler has to read the request
+// body once the headers are parsed. Zero means no limit.
+func WithReadBodyTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.readBodyTimeout = d
+	}
+}
+
+// WithWriteTimeout bounds the time the handler has to write its response
+// once the request headers are parsed. Zero means no limit.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.writeTimeout = d
+	}
+}
+
+// WithMaxRequestsPerConn caps how many requests a single connection may
+// serve before the server closes it. Zero means no limit.
+func WithMaxRequestsPerConn(n int) Option {
+	return func(c *config) {
+		c.maxRequestsPerConn = n
+	}
+}
+
+// WithBufferedBody makes the server read each request body into
+// Request.Body before calling the handler, instead of streaming it through
+// Request.BodyReader.
+func WithBufferedBody() Option {
+	return func(c *config) {
+		c.bufferBody = true
+	}
+}
+
+// WithLimits sets the request size limits, replacing request.DefaultLimits.
+// Requests over a limit are answered with 414, 431 or 413.
+func WithLimits(limits request.Limits) Option {
+	return func(c *config) {
+		c.limits = limits
+	}
+}
+
+// WithHeaderFormat sets the field order and casing used for response
+// headers and trailers.
+func WithHeaderFormat(format response.HeaderFormat) Option {
+	return func(c *config) {
+		c.headerFormat = format
+	}
+}
+
+// WithHeaderParseOptions sets how request header and trailer fields are
+// parsed, e.g. whether obsolete line folding is unfolded or rejected.
+func WithHeaderParseOptions(opts headers.ParseOptions) Option {
+	return func(c *config) {
+		c.headerOptions = opts
+	}
+}
+
+// WithTrace makes the server answer TRACE requests itself by echoing the
+// request back as message/http, minus credentials. Without it TRACE is
+// answered with 501 Not Implemented and never reaches the handler.
+func WithTrace() Option {
+	return func(c *config) {
+		c.trace = true
+	}
+}
+
+// deadline turns a timeout into a conn deadline, where zero means none.
+func deadline(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
@@ -1,42 +1,160 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/jacobdanielrose/httpfromtcp/internal/request"
 	"github.com/jacobdanielrose/httpfromtcp/internal/response"
 )
 
+const (
+	lingerTimeout        = 500 * time.Millisecond
+	lingerMaxBytes       = 256 << 10
+	shutdownPollInterval = 10 * time.Millisecond
+)
+
 type Handler func(w *response.Writer, req *request.Request)
 
 type Server struct {
 	handler  Handler
 	listener net.Listener
 	closed   atomic.Bool
+	cfg      config
+
+	mu    sync.Mutex
+	conns map[net.Conn]connState
 }
 
-func Serve(port int, handler Handler) (*Server, error) {
-	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%v", port))
+type connState int
+
+const (
+	// connIdle is a connection waiting for its next request
+	connIdle connState = iota
+	// connActive is a connection with a request being read or handled
+	connActive
+)
+
+// Serve listens on the given port on localhost. Port 0 picks a free port,
+// which Addr reports.
+func Serve(port int, handler Handler, opts ...Option) (*Server, error) {
+	return ListenAndServe(fmt.Sprintf("localhost:%v", port), handler, opts...)
+}
+
+// ListenAndServe listens on addr, either a TCP "host:port" such as
+// "0.0.0.0:8080" or "[::1]:0", or "unix:" followed by a socket path.
+func ListenAndServe(addr string, handler Handler, opts ...Option) (*Server, error) {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", path
+	}
+	listener, err := net.Listen(network, addr)
 	if err != nil {
 		return nil, err
 	}
+	return ServeListener(listener, handler, opts...), nil
+}
+
+// ServeListener serves connections accepted from an existing listener. The
+// server takes ownership of it and closes it on Close or Shutdown.
+func ServeListener(listener net.Listener, handler Handler, opts ...Option) *Server {
 	server := &Server{
 		handler:  handler,
 		listener: listener,
+		conns:    map[net.Conn]connState{},
+		cfg:      config{limits: request.DefaultLimits},
+	}
+	for _, opt := range opts {
+		opt(&server.cfg)
 	}
 	go server.listen()
-	return server, nil
+	return server
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
 }
 
+// Close stops accepting connections and immediately closes every open one,
+// abandoning in-flight requests. Use Shutdown to let them finish.
 func (s *Server) Close() error {
 	s.closed.Store(true)
-	if s.listener != nil {
-		return s.listener.Close()
+	err := s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// Shutdown stops accepting connections, closes idle ones and waits for
+// in-flight requests to finish before closing their connections. If ctx ends
+// first, the remaining connections are closed and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closed.Store(true)
+	err := s.listener.Close()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdleConns closes connections waiting for a request and reports
+// whether no connections remain.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, state := range s.conns {
+		if state == connIdle {
+			conn.Close()
+			delete(s.conns, conn)
+		}
 	}
-	return nil
+	return len(s.conns) == 0
+}
+
+// setConnState records the state of a connection. It reports false if the
+// connection should be closed instead: the server is shutting down and the
+// connection is idle, or Shutdown already closed it.
+func (s *Server) setConnState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if state == connIdle && s.closed.Load() {
+		delete(s.conns, conn)
+		return false
+	}
+	if _, tracked := s.conns[conn]; !tracked && state == connActive {
+		return false
+	}
+	s.conns[conn] = state
+	return true
+}
+
+func (s *Server) forgetConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
 }
 
 func (s *Server) listen() {
@@ -49,20 +167,203 @@ func (s *Server) listen() {
 			log.Printf("Error accepting connection: %v", err)
 			continue
 		}
+		if !s.setConnState(conn, connIdle) {
+			conn.Close()
+			return
+		}
 		go s.handle(conn)
 	}
 }
 
 func (s *Server) handle(conn net.Conn) {
+	defer closeConn(conn)
+	defer s.forgetConn(conn)
+	reader := request.NewReader(conn)
+	reader.Limits = s.cfg.limits
+	reader.HeaderOptions = s.cfg.headerOptions
+	for served := 0; ; served++ {
+		if !s.setConnState(conn, connIdle) {
+			return
+		}
+		conn.SetReadDeadline(deadline(s.cfg.idleTimeout))
+		if err := reader.WaitForRequest(); err != nil {
+			return
+		}
+		if !s.setConnState(conn, connActive) {
+			return
+		}
+
+		conn.SetReadDeadline(deadline(s.cfg.readHeaderTimeout))
+		req, err := reader.ReadRequest()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return
+			}
+			s.writeParseError(conn, err)
+			return
+		}
+		conn.SetReadDeadline(deadline(s.cfg.readBodyTimeout))
+		conn.SetWriteDeadline(deadline(s.cfg.writeTimeout))
+		w := response.NewWriter(conn)
+		w.SetHeaderFormat(s.cfg.headerFormat)
+		w.SetVersion(req.RequestLine.HttpVersion)
+		w.SetMethod(req.RequestLine.Method)
+		if req.ExpectsContinue() {
+			req.OnBodyRead(func() error {
+				return sendContinue(w)
+			})
+		}
+		if s.cfg.bufferBody {
+			if err := req.BufferBody(); err != nil {
+				s.writeParseError(conn, err)
+				return
+			}
+		}
+
+		lastRequest := s.cfg.maxRequestsPerConn > 0 && served+1 >= s.cfg.maxRequestsPerConn
+		w.SetClose(lastRequest || s.closed.Load() || !wantsKeepAlive(req))
+		w.SetCloseCheck(func() bool {
+			// a body left unread that is too large to skip also ends
+			// the connection
+			return s.closed.Load() || req.BodyTooLargeToDiscard()
+		})
+		if req.RequestLine.Method == "TRACE" {
+			s.serveTrace(w, req)
+		} else if !s.callHandler(w, req) {
+			return
+		}
+		if err := req.BodyError(); err != nil {
+			// the handler saw a bad body; answer it if the response has not
+			// started, otherwise end the response and drop the connection
+			if !w.Written() {
+				s.writeParseError(conn, err)
+				return
+			}
+			w.SetClose(true)
+			w.Finish()
+			return
+		}
+		if req.BodyWithheld() {
+			// the client never got 100 Continue, so the connection cannot
+			// be reused past a body that may never come
+			w.SetClose(true)
+		}
+		if err := w.Finish(); err != nil {
+			if !w.Written() {
+				log.Printf("bad response to %s %s: %v", req.RequestLine.Method, req.RequestLine.RequestTarget, err)
+				writeInternalError(w)
+			}
+			return
+		}
+		if !w.KeepAlive() {
+			return
+		}
+		if err := reader.DiscardBody(); err != nil {
+			return
+		}
+	}
+}
+
+// wantsKeepAlive reports whether the client wants to keep the connection
+// open: HTTP/1.1 does unless it sends "Connection: close", HTTP/1.0 only if
+// it sends "Connection: keep-alive".
+func wantsKeepAlive(req *request.Request) bool {
+	if req.RequestLine.HttpVersion == "1.0" {
+		return req.Headers.HasToken("Connection", "keep-alive")
+	}
+	return !req.Headers.HasToken("Connection", "close")
+}
+
+// sendContinue tells a client waiting on "Expect: 100-continue" to send the
+// body, unless the final response has already started.
+func sendContinue(w *response.Writer) error {
+	if w.Written() {
+		return nil
+	}
+	return w.WriteInformational(response.StatusContinue, nil)
+}
+
+// callHandler runs the handler, recovering a panic so it cannot crash the
+// process. It reports false if the handler panicked, in which case the
+// connection must not be reused: a 500 is sent if nothing had been written
+// yet, otherwise the partial response is abandoned.
+func (s *Server) callHandler(w *response.Writer, req *request.Request) (ok bool) {
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		}
+		ok = false
+		log.Printf("panic serving %s %s: %v\n%s", req.RequestLine.Method, req.RequestLine.RequestTarget, p, debug.Stack())
+		if !w.Written() {
+			writeInternalError(w)
+		}
+	}()
+	s.handler(w, req)
+	return true
+}
+
+// writeInternalError replaces a response that has not been sent with a 500
+// and marks the connection for closing.
+func writeInternalError(w *response.Writer) {
+	w.Reset()
+	w.SetClose(true)
+	w.WriteStatusLine(response.StatusInternalServerError)
+	body := []byte("Internal Server Error")
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+// closeConn shuts the connection down gracefully. Closing a socket that still
+// holds unread request bytes makes the kernel send a RST, which can destroy a
+// response the client has not read yet, so the write side is closed first and
+// the remaining input drained for a short while.
+func closeConn(conn net.Conn) {
 	defer conn.Close()
-	w := response.NewWriter(conn)
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		w.WriteStatusLine(response.StatusBadRequest)
-		body := []byte(fmt.Sprintf("Error parsing request: %v", err))
-		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
-		w.WriteBody(body)
+	halfCloser, ok := conn.(interface{ CloseWrite() error })
+	if !ok {
 		return
 	}
-	s.handler(w, req)
+	if err := halfCloser.CloseWrite(); err != nil {
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(lingerTimeout))
+	io.CopyN(io.Discard, conn, lingerMaxBytes)
+}
+
+// writeParseError answers a request that could not be parsed before the
+// connection is dropped, in HTTP/1.0 if that is what the client spoke.
+func (s *Server) writeParseError(conn net.Conn, err error) {
+	conn.SetWriteDeadline(deadline(s.cfg.writeTimeout))
+	w := response.NewWriter(conn)
+	var parseErr *request.ParseError
+	if errors.As(err, &parseErr) && parseErr.Version == "1.0" {
+		w.SetVersion("1.0")
+	}
+	w.SetHeaderFormat(s.cfg.headerFormat)
+	w.SetClose(true)
+	w.WriteStatusLine(parseErrorStatus(err))
+	body := []byte(fmt.Sprintf("Error parsing request: %v", err))
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func parseErrorStatus(err error) response.StatusCode {
+	switch {
+	case errors.Is(err, request.ErrRequestLineTooLong):
+		return response.StatusURITooLong
+	case errors.Is(err, request.ErrHeaderTooLarge):
+		return response.StatusHeaderFieldsTooLarge
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return response.StatusContentTooLarge
+	case errors.Is(err, request.ErrUnsupportedTransferEncoding):
+		return response.StatusNotImplemented
+	case errors.Is(err, request.ErrUnsupportedVersion):
+		return response.StatusHTTPVersionNotSupported
+	case errors.Is(err, request.ErrUnsupportedExpectation):
+		return response.StatusExpectationFailed
+	default:
+		return response.StatusBadRequest
+	}
 }
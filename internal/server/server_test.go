@@ -0,0 +1,508 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/headers"
+	"github.com/jacobdanielrose/httpfromtcp/internal/request"
+	"github.com/jacobdanielrose/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startServer(t *testing.T, handler Handler, opts ...Option) net.Conn {
+	t.Helper()
+	_, conn := startServerConn(t, handler, opts...)
+	return conn
+}
+
+func startServerConn(t *testing.T, handler Handler, opts ...Option) (*Server, net.Conn) {
+	t.Helper()
+	s, err := Serve(0, handler, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s, dial(t, s)
+}
+
+func dial(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func okHandler(w *response.Writer, req *request.Request) {
+	w.WriteStatusLine(response.StatusOK)
+	body := []byte(req.RequestLine.RequestTarget)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestKeepAlive(t *testing.T) {
+	conn := startServer(t, okHandler)
+	_, err := io.WriteString(conn, "GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /two HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "\r\n\r\n/one")
+	assert.Contains(t, string(out), "Connection: close\r\n")
+	assert.Contains(t, string(out), "\r\n\r\n/two")
+
+	// Test: Large unread body closes the connection instead of being drained
+	conn = startServer(t, okHandler)
+	_, err = io.WriteString(conn, "POST /big HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100000000\r\n\r\nxxxx")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "Connection: close\r\n")
+	assert.True(t, strings.HasSuffix(string(out), "\r\n\r\n/big"))
+}
+
+func TestHTTP10KeepAlive(t *testing.T) {
+	// Test: HTTP/1.0 closes after the response by default
+	conn := startServer(t, okHandler)
+	_, err := io.WriteString(conn, "GET /one HTTP/1.0\r\n\r\nGET /two HTTP/1.0\r\n\r\n")
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.0 200 OK\r\n"))
+	assert.Contains(t, string(out), "Connection: close\r\n")
+	assert.NotContains(t, string(out), "/two")
+
+	// Test: "Connection: keep-alive" keeps it open
+	conn = startServer(t, okHandler)
+	_, err = io.WriteString(conn, "GET /one HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"+
+		"GET /two HTTP/1.0\r\n\r\n")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "Connection: keep-alive\r\n\r\n/one")
+	assert.Contains(t, string(out), "Connection: close\r\n\r\n/two")
+}
+
+func TestHeadRequest(t *testing.T) {
+	conn := startServer(t, okHandler)
+	_, err := io.WriteString(conn, "HEAD /one HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /two HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 200 OK\r\nContent-Length: 4\r\n"))
+	assert.NotContains(t, string(out), "/one")
+	assert.Contains(t, string(out), "\r\n\r\nHTTP/1.1 200 OK\r\n")
+	assert.Contains(t, string(out), "\r\n\r\n/two")
+}
+
+func TestTrace(t *testing.T) {
+	handled := false
+	handler := func(w *response.Writer, req *request.Request) {
+		handled = true
+		okHandler(w, req)
+	}
+	trace := "TRACE /echo HTTP/1.1\r\nHost: localhost\r\nAuthorization: Basic c2VjcmV0\r\nX-Trace: 1\r\nConnection: close\r\n\r\n"
+
+	// Test: TRACE is refused by default
+	conn := startServer(t, handler)
+	_, err := io.WriteString(conn, trace)
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 501 Not Implemented\r\n"))
+	assert.False(t, handled)
+
+	// Test: Enabled TRACE echoes the request without credentials
+	conn = startServer(t, handler, WithTrace())
+	_, err = io.WriteString(conn, trace)
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, string(out), "Content-Type: message/http\r\n")
+	assert.True(t, strings.HasSuffix(string(out), "\r\n\r\nTRACE /echo HTTP/1.1\r\nHost: localhost\r\nX-Trace: 1\r\nConnection: close\r\n\r\n"))
+	assert.NotContains(t, string(out), "c2VjcmV0")
+	assert.False(t, handled)
+}
+
+func TestExpectContinue(t *testing.T) {
+	echo := func(w *response.Writer, req *request.Request) {
+		body, err := io.ReadAll(req.BodyReader)
+		if err != nil {
+			return
+		}
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+	const head = "POST /upload HTTP/1.1\r\nHost: localhost\r\nExpect: 100-continue\r\nContent-Length: 5\r\n\r\n"
+
+	// Test: 100 Continue is sent once the handler reads the body
+	conn := startServer(t, echo)
+	_, err := io.WriteString(conn, head)
+	require.NoError(t, err)
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 100 Continue\r\n", line)
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "\r\n", line)
+	_, err = io.WriteString(conn, "hello")
+	require.NoError(t, err)
+	line, err = r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", line)
+
+	// Test: Handler rejecting without reading gets no 100 and the
+	// connection is closed rather than waiting for the body
+	conn = startServer(t, func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusContentTooLarge)
+		w.WriteHeaders(response.GetDefaultHeaders(0))
+	})
+	_, err = io.WriteString(conn, head)
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 413 Content Too Large\r\n"))
+	assert.NotContains(t, string(out), "100 Continue")
+
+	// Test: Implicit rejection announces the close
+	conn = startServer(t, func(w *response.Writer, _ *request.Request) {
+		w.SetStatus(response.StatusUnauthorized)
+	})
+	_, err = io.WriteString(conn, head)
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 401 Unauthorized\r\n"))
+	assert.Contains(t, string(out), "Connection: close\r\n")
+
+	// Test: Unknown expectation
+	conn = startServer(t, echo)
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nExpect: magic\r\nContent-Length: 0\r\n\r\n")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 417 Expectation Failed\r\n"))
+}
+
+func TestAutoFraming(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(headers.NewHeaders())
+		if req.RequestLine.Target.Path == "/big" {
+			io.WriteString(w, strings.Repeat("x", response.DefaultBufferSize+1))
+			return
+		}
+		io.WriteString(w, "small")
+	})
+	_, err := io.WriteString(conn, "GET /small HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /big HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "Content-Length: 5\r\n\r\nsmall")
+	assert.Contains(t, string(out), "Transfer-Encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(string(out), "\r\n0\r\n\r\n"))
+}
+
+func TestUnterminatedChunkedResponse(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		h := headers.NewHeaders()
+		h.Set("Transfer-Encoding", "chunked")
+		w.WriteHeaders(h)
+		w.WriteChunkedBody([]byte(req.RequestLine.Target.Path))
+	})
+	_, err := io.WriteString(conn, "GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /two HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "4\r\n/one\r\n0\r\n\r\nHTTP/1.1 200 OK")
+	assert.True(t, strings.HasSuffix(string(out), "4\r\n/two\r\n0\r\n\r\n"))
+}
+
+func TestImplicitResponse(t *testing.T) {
+	conn := startServer(t, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.Target.Path == "/empty" {
+			w.SetStatus(response.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, req.RequestLine.Target.Path)
+	})
+	_, err := io.WriteString(conn, "GET /empty HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /two HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 204 No Content\r\n\r\nHTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, string(out), "Content-Length: 4\r\n")
+	assert.True(t, strings.HasSuffix(string(out), "\r\n\r\n/two"))
+
+	// Test: Response that cannot be committed becomes a 500
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	conn = startServer(t, func(w *response.Writer, _ *request.Request) {
+		w.Header().Set("Trailer", "Content-Type")
+		io.WriteString(w, "hello")
+	})
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, string(out), "hello")
+}
+
+func TestMaxRequestsPerConn(t *testing.T) {
+	conn := startServer(t, okHandler, WithMaxRequestsPerConn(1))
+	_, err := io.WriteString(conn, "GET /one HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+		"GET /two HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "\r\n\r\n/one")
+	assert.NotContains(t, string(out), "/two")
+}
+
+func TestHandlerPanic(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// Test: Panic before anything is written becomes a 500
+	conn := startServer(t, func(*response.Writer, *request.Request) {
+		panic("boom")
+	})
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1 500 Internal Server Error\r\n", line)
+
+	// Test: Panic while the response is still buffered becomes a 500
+	conn = startServer(t, func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		io.WriteString(w, "partial")
+		panic("boom")
+	})
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 500 Internal Server Error\r\n"))
+	assert.NotContains(t, string(out), "partial")
+
+	// Test: Panic after the headers are sent aborts the connection
+	conn = startServer(t, func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(10))
+		panic("boom")
+	})
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(out), "\r\n\r\n"))
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s, busy := startServerConn(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+		okHandler(w, req)
+	})
+	idle := dial(t, s)
+
+	_, err := io.WriteString(busy, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+
+	// Test: Idle connection is closed without a response
+	out, err := io.ReadAll(idle)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	// Test: Shutdown waits for the in-flight request
+	select {
+	case <-shutdownErr:
+		t.Fatal("Shutdown returned before the handler finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	out, err = io.ReadAll(busy)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "\r\n\r\n/slow")
+
+	// Test: Drained response announces the close
+	assert.Contains(t, string(out), "Connection: close\r\n")
+	require.NoError(t, <-shutdownErr)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	s, conn := startServerConn(t, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+	})
+	_, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	out, _ := io.ReadAll(conn)
+	assert.Empty(t, out)
+}
+
+func TestListenAddresses(t *testing.T) {
+	// Test: Pre-built listener
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := ServeListener(listener, okHandler)
+	t.Cleanup(func() { s.Close() })
+	conn := dial(t, s)
+	_, err = io.WriteString(conn, "GET /listener HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "\r\n\r\n/listener")
+
+	// Test: Unix socket
+	path := filepath.Join(t.TempDir(), "server.sock")
+	s, err = ListenAndServe("unix:"+path, okHandler)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	conn, err = net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET /unix HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "\r\n\r\n/unix")
+}
+
+func TestTimeouts(t *testing.T) {
+	// Test: Idle connection is closed after the idle timeout
+	conn := startServer(t, okHandler, WithIdleTimeout(20*time.Millisecond))
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	// Test: Headers that never finish hit the read-header timeout
+	conn = startServer(t, okHandler, WithReadHeaderTimeout(20*time.Millisecond))
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: local")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	// Test: A body that never arrives hits the read-body timeout
+	conn = startServer(t, okHandler, WithReadBodyTimeout(20*time.Millisecond), WithBufferedBody())
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nabc")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "200 OK")
+
+	// Test: Parse error after an idle gap still gets a fresh write deadline
+	conn = startServer(t, okHandler, WithWriteTimeout(200*time.Millisecond))
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	time.Sleep(400 * time.Millisecond)
+	_, err = io.WriteString(conn, "BAD\r\n\r\n")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "HTTP/1.1 400 Bad Request\r\n")
+}
+
+func TestLimitResponses(t *testing.T) {
+	limits := request.Limits{
+		MaxRequestLineBytes: 32,
+		MaxHeaderLineBytes:  32,
+		MaxBodyBytes:        4,
+	}
+	cases := map[string]string{
+		"GET /" + strings.Repeat("a", 40) + " HTTP/1.1\r\n\r\n":                "HTTP/1.1 414 URI Too Long\r\n",
+		"GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("b", 40) + "\r\n\r\n":     "HTTP/1.1 431 Request Header Fields Too Large\r\n",
+		"POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello": "HTTP/1.1 413 Content Too Large\r\n",
+		"GET / HTTP/1.0\r\nX-Big: " + strings.Repeat("b", 40) + "\r\n\r\n":     "HTTP/1.0 431 Request Header Fields Too Large\r\n",
+	}
+	for input, want := range cases {
+		conn := startServer(t, okHandler, WithLimits(limits))
+		_, err := io.WriteString(conn, input)
+		require.NoError(t, err)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, want, line)
+	}
+}
+
+func TestStreamedBodyErrors(t *testing.T) {
+	limits := request.Limits{MaxBodyBytes: 4}
+	readAll := func(w *response.Writer, req *request.Request) {
+		io.ReadAll(req.BodyReader)
+		w.Write([]byte("ok"))
+	}
+	chunked := "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n"
+
+	// Test: Body over the limit is answered with 413
+	conn := startServer(t, readAll, WithLimits(limits))
+	_, err := io.WriteString(conn, chunked+"10\r\n0123456789abcdef\r\n0\r\n\r\n")
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 413 Content Too Large\r\n"))
+	assert.Contains(t, string(out), "Connection: close\r\n")
+
+	// Test: Malformed chunk is answered with 400
+	conn = startServer(t, readAll)
+	_, err = io.WriteString(conn, chunked+"zz\r\n")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 400 Bad Request\r\n"))
+
+	// Test: Response already sent ends the connection
+	started := func(w *response.Writer, req *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		w.WriteHeaders(response.GetDefaultHeaders(2))
+		io.ReadAll(req.BodyReader)
+		w.Write([]byte("ok"))
+	}
+	conn = startServer(t, started, WithLimits(limits))
+	_, err = io.WriteString(conn, chunked+"10\r\n0123456789abcdef\r\n0\r\n\r\n")
+	require.NoError(t, err)
+	out, err = io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(out), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(string(out), "\r\n\r\nok"))
+}
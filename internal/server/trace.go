@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/request"
+	"github.com/jacobdanielrose/httpfromtcp/internal/response"
+)
+
+// traceExcluded are request fields left out of a TRACE echo because they
+// carry credentials (RFC 9110 section 9.3.8).
+var traceExcluded = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// serveTrace answers a TRACE request according to the server's policy.
+func (s *Server) serveTrace(w *response.Writer, req *request.Request) {
+	if !s.cfg.trace {
+		w.WriteStatusLine(response.StatusNotImplemented)
+		body := []byte("TRACE is not supported")
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s HTTP/%s\r\n", req.RequestLine.Method, req.RequestLine.RequestTarget, req.RequestLine.HttpVersion)
+	for name, value := range req.Headers.All() {
+		if !excludedFromTrace(name) {
+			fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+		}
+	}
+	b.WriteString("\r\n")
+
+	body := []byte(b.String())
+	h := response.GetDefaultHeaders(len(body))
+	h.Set("Content-Type", "message/http")
+	w.WriteStatusLine(response.StatusOK)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+func excludedFromTrace(name string) bool {
+	for _, excluded := range traceExcluded {
+		if strings.EqualFold(name, excluded) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package vhost
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/request"
+	"github.com/jacobdanielrose/httpfromtcp/internal/response"
+	"github.com/jacobdanielrose/httpfromtcp/internal/server"
+)
+
+// Dispatcher routes requests to handlers by the host they are addressed to.
+// Patterns are host names such as "tools.example.com", or "*.example.com"
+// to match any subdomain of example.com at any depth (but not example.com
+// itself). Matching ignores case, any port, a trailing dot and the brackets
+// of an IPv6 address; an exact pattern beats a wildcard, and a longer
+// wildcard beats a shorter one.
+type Dispatcher struct {
+	exact     map[string]server.Handler
+	wildcards map[string]server.Handler
+	fallback  server.Handler
+}
+
+func New() *Dispatcher {
+	return &Dispatcher{
+		exact:     map[string]server.Handler{},
+		wildcards: map[string]server.Handler{},
+	}
+}
+
+// Handle registers handler for the host pattern, which may also be an IP
+// address, with IPv6 written either bare or in brackets as in "[::1]". A bad
+// or repeated pattern is a mistake in setting up the server, not something a
+// request can cause, so Handle panics on one.
+func (d *Dispatcher) Handle(pattern string, handler server.Handler) {
+	host := normalize(pattern)
+	routes := d.exact
+	suffix, wildcard := strings.CutPrefix(host, "*.")
+	if wildcard {
+		host, routes = suffix, d.wildcards
+	}
+	// only an IPv6 address may contain a colon, and it has no subdomains
+	ipv6 := !wildcard && net.ParseIP(host) != nil
+	if host == "" || strings.ContainsAny(host, "*/") || strings.Contains(host, ":") && !ipv6 {
+		panic(fmt.Sprintf("vhost: bad pattern %q", pattern))
+	}
+	if _, exists := routes[host]; exists {
+		panic(fmt.Sprintf("vhost: pattern %q registered twice", pattern))
+	}
+	routes[host] = handler
+}
+
+// HandleDefault registers the handler for requests no pattern matches,
+// including HTTP/1.0 requests without a Host header.
+func (d *Dispatcher) HandleDefault(handler server.Handler) {
+	d.fallback = handler
+}
+
+// Serve is a server.Handler that dispatches to the handler for the request's
+// host, falling back to the default handler and then to 421 Misdirected
+// Request.
+func (d *Dispatcher) Serve(w *response.Writer, req *request.Request) {
+	if handler := d.match(normalize(req.Host())); handler != nil {
+		handler(w, req)
+		return
+	}
+	if d.fallback != nil {
+		d.fallback(w, req)
+		return
+	}
+	misdirected(w)
+}
+
+func (d *Dispatcher) match(host string) server.Handler {
+	if host == "" {
+		return nil
+	}
+	if handler, ok := d.exact[host]; ok {
+		return handler
+	}
+	// try the longest parent domain first
+	for i := strings.IndexByte(host, '.'); i >= 0; {
+		if handler, ok := d.wildcards[host[i+1:]]; ok {
+			return handler
+		}
+		next := strings.IndexByte(host[i+1:], '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil
+}
+
+// normalize lower-cases a host and strips its port, trailing dot and the
+// brackets around an IPv6 address.
+func normalize(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func misdirected(w *response.Writer) {
+	w.WriteStatusLine(response.StatusMisdirectedRequest)
+	body := []byte("421 misdirected request\n")
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
@@ -0,0 +1,79 @@
+package vhost
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jacobdanielrose/httpfromtcp/internal/request"
+	"github.com/jacobdanielrose/httpfromtcp/internal/response"
+	"github.com/jacobdanielrose/httpfromtcp/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(d *Dispatcher, requestHead string) string {
+	buf := &bytes.Buffer{}
+	req, err := request.RequestFromReader(strings.NewReader(requestHead + "\r\n"))
+	if err != nil {
+		panic(err)
+	}
+	d.Serve(response.NewWriter(buf), req)
+	return buf.String()
+}
+
+func named(name string) server.Handler {
+	return func(w *response.Writer, _ *request.Request) {
+		w.WriteStatusLine(response.StatusOK)
+		body := []byte(name)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	d := New()
+	d.Handle("example.com", named("apex"))
+	d.Handle("*.example.com", named("sub"))
+	d.Handle("*.tools.example.com", named("tools"))
+	d.Handle("admin.tools.example.com", named("admin"))
+
+	// Test: Exact match ignores case, port and trailing dot
+	assert.Contains(t, serve(d, "GET / HTTP/1.1\r\nHost: Example.COM.:8080\r\n"), "\r\n\r\napex")
+
+	// Test: Wildcard matches subdomains at any depth
+	assert.Contains(t, serve(d, "GET / HTTP/1.1\r\nHost: wiki.example.com\r\n"), "\r\n\r\nsub")
+	assert.Contains(t, serve(d, "GET / HTTP/1.1\r\nHost: a.b.example.com\r\n"), "\r\n\r\nsub")
+
+	// Test: Longest wildcard and exact pattern win
+	assert.Contains(t, serve(d, "GET / HTTP/1.1\r\nHost: ci.tools.example.com\r\n"), "\r\n\r\ntools")
+	assert.Contains(t, serve(d, "GET / HTTP/1.1\r\nHost: admin.tools.example.com\r\n"), "\r\n\r\nadmin")
+
+	// Test: Absolute-form target overrides the Host header
+	assert.Contains(t, serve(d, "GET http://example.com/ HTTP/1.1\r\nHost: other.org\r\n"), "\r\n\r\napex")
+
+	// Test: IPv6 address with or without a port
+	d.Handle("[::1]", named("loopback"))
+	assert.Contains(t, serve(d, "GET / HTTP/1.1\r\nHost: [::1]\r\n"), "\r\n\r\nloopback")
+	assert.Contains(t, serve(d, "GET / HTTP/1.1\r\nHost: [::1]:8080\r\n"), "\r\n\r\nloopback")
+
+	// Test: Unknown host is misdirected
+	out := serve(d, "GET / HTTP/1.1\r\nHost: example.org\r\n")
+	assert.Contains(t, out, "HTTP/1.1 421 Misdirected Request")
+	out = serve(d, "GET / HTTP/1.1\r\nHost: notexample.com\r\n")
+	assert.Contains(t, out, "HTTP/1.1 421 Misdirected Request")
+
+	// Test: Default handler catches the rest, including no Host at all
+	d.HandleDefault(named("default"))
+	assert.Contains(t, serve(d, "GET / HTTP/1.1\r\nHost: example.org\r\n"), "\r\n\r\ndefault")
+	assert.Contains(t, serve(d, "GET / HTTP/1.0\r\n"), "\r\n\r\ndefault")
+}
+
+func TestBadPatterns(t *testing.T) {
+	for _, pattern := range []string{"", "*.", "a.*.com", "*", "example.com/path", "a:b:c", "*.[::1]"} {
+		require.Panics(t, func() { New().Handle(pattern, named("x")) }, pattern)
+	}
+	d := New()
+	d.Handle("example.com", named("x"))
+	require.Panics(t, func() { d.Handle("EXAMPLE.com", named("y")) })
+}